@@ -16,7 +16,18 @@ func NewCmdController() *cobra.Command {
 		Short: "Runs ldhdns in controller mode",
 		Args:  cobra.NoArgs,
 		Run: func(_ *cobra.Command, args []string) {
-			if err := controller.Run(networkId, domainSuffix, subDomainLabel, containerName); err != nil {
+			if err := validateDomainSuffixes(); err != nil {
+				log.Fatal(err)
+			}
+
+			config := controller.Config{
+				NetworkId:      networkId,
+				DomainSuffixes: domainSuffixes,
+				SubDomainLabel: subDomainLabel,
+				ContainerName:  containerName,
+				EmbeddedDNS:    embeddedDns,
+			}
+			if err := controller.Run(config); err != nil {
 				log.Fatal(err)
 			}
 		},
@@ -28,11 +39,11 @@ func NewCmdController() *cobra.Command {
 		defaultNetworkId,
 		"Network name of managed docker bridge network.")
 
-	cmd.Flags().StringVar(
-		&domainSuffix,
+	cmd.Flags().StringSliceVar(
+		&domainSuffixes,
 		"domain-suffix",
-		defaultDomainSuffix,
-		"Domain name suffix for DNS resolution.")
+		[]string{defaultDomainSuffix},
+		"Domain name suffixes for DNS resolution, optionally mapped to their own label as <suffix>=<label>.")
 
 	cmd.Flags().StringVar(
 		&subDomainLabel,
@@ -46,5 +57,11 @@ func NewCmdController() *cobra.Command {
 		defaultContainerName,
 		"Name of the container running the controller.")
 
+	cmd.Flags().BoolVar(
+		&embeddedDns,
+		"embedded-dns",
+		false,
+		"Run the built-in DNS server instead of dnsmasq in the DNS container.")
+
 	return cmd
 }
@@ -16,35 +16,299 @@ func NewCmdDns() *cobra.Command {
 		Short: "Runs ldhdns in DNS mode",
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := dns.Run(domainSuffix, subDomainLabel, dnsmasqHostsDirectory, dnsmasqPidFile); err != nil {
+			if err := validateDomainSuffixes(); err != nil {
+				log.Fatal(err)
+			}
+			if err := dns.Run(dnsConfig()); err != nil {
 				log.Fatal(err)
 			}
 		},
 	}
 
-	cmd.Flags().StringVar(
-		&domainSuffix,
+	cmd.PersistentFlags().StringSliceVar(
+		&domainSuffixes,
 		"domain-suffix",
-		defaultDomainSuffix,
-		"Domain name suffix for DNS resolution.")
+		[]string{defaultDomainSuffix},
+		"Domain name suffixes for DNS resolution, optionally mapped to their own label as <suffix>=<label>.")
 
-	cmd.Flags().StringVar(
+	cmd.PersistentFlags().StringVar(
 		&subDomainLabel,
 		"subdomain-label",
 		defaultSubDomainLabel,
 		"Name of the label used to provide the sub-domain of a container.")
 
+	cmd.PersistentFlags().BoolVar(
+		&composeNames,
+		"compose-names",
+		false,
+		"Register containers without a sub-domain label as <service>.<project> using their docker compose labels.")
+
+	cmd.PersistentFlags().BoolVar(
+		&composeNumberedNames,
+		"compose-numbered-names",
+		false,
+		"Also register compose containers as <service>-<n>.<project> using their container number.")
+
+	cmd.PersistentFlags().BoolVar(
+		&replicaNames,
+		"replica-names",
+		false,
+		"Also register each name as <n>.<name> using the compose container number or short container ID.")
+
+	cmd.PersistentFlags().StringVar(
+		&networkLabel,
+		"network-label",
+		defaultNetworkLabel,
+		"Name of the label used to restrict the network(s) whose addresses are published for a container.")
+
+	cmd.PersistentFlags().StringSliceVar(
+		&preferNetworks,
+		"prefer-network",
+		nil,
+		"Networks, in order of preference, to publish the only address of containers attached to them.")
+
+	cmd.PersistentFlags().StringVar(
+		&networkId,
+		"network-id",
+		defaultNetworkId,
+		"Network name of managed docker bridge network.")
+
+	cmd.PersistentFlags().BoolVar(
+		&bridgeFirst,
+		"bridge-first",
+		false,
+		"Publish the address on the managed bridge network first for containers attached to it.")
+
+	cmd.PersistentFlags().StringVar(
+		&srvLabel,
+		"srv-label",
+		defaultSrvLabel,
+		"Name of the label used to provide SRV records of a container as _<service>._<proto>:<port>.")
+
+	cmd.PersistentFlags().BoolVar(
+		&srvExposedPorts,
+		"srv-exposed-ports",
+		false,
+		"Publish SRV records for the exposed ports of containers.")
+
+	cmd.PersistentFlags().StringVar(
+		&cnameLabel,
+		"cname-label",
+		defaultCnameLabel,
+		"Name of the label used to publish the names of a container as aliases of another name.")
+
+	cmd.PersistentFlags().StringVar(
+		&wildcardLabel,
+		"wildcard-label",
+		defaultWildcardLabel,
+		"Name of the label used to also publish the records of a container for any name within its names.")
+
+	cmd.PersistentFlags().BoolVar(
+		&txtRecords,
+		"txt-records",
+		false,
+		"Publish the container ID, image, compose project and service, and start time of containers as TXT records.")
+
+	cmd.PersistentFlags().StringSliceVar(
+		&upstreams,
+		"upstream",
+		nil,
+		"Upstream DNS servers, as <ip>[:<port>], to forward queries for names outside the domains to.")
+
+	cmd.PersistentFlags().Uint32Var(
+		&ttl,
+		"default-ttl",
+		defaultTTL,
+		"TTL, in seconds, of the records of containers without a TTL label.")
+
+	cmd.PersistentFlags().StringVar(
+		&ttlLabel,
+		"ttl-label",
+		defaultTtlLabel,
+		"Name of the label used to provide the TTL, in seconds, of the records of a container.")
+
+	cmd.PersistentFlags().Uint32Var(
+		&negativeTTL,
+		"negative-ttl",
+		defaultNegativeTTL,
+		"TTL, in seconds, for which resolvers cache the absence of names within the domains. Only honoured by \"dns serve\".")
+
+	cmd.PersistentFlags().StringVar(
+		&staticRecordsFile,
+		"static-records",
+		"",
+		"Hosts file of static records, such as for the host or VMs, watched for changes. Container records win on conflicts.")
+
+	cmd.PersistentFlags().StringVar(
+		&hostName,
+		"host-name",
+		defaultHostName,
+		"Name published within each domain for the gateway of the docker networks, i.e. the host. Empty disables it.")
+
+	cmd.PersistentFlags().StringSliceVar(
+		&hostGateways,
+		"host-gateway",
+		nil,
+		"Gateways of the docker networks, as <network>=<ip>, as provided by the controller.")
+
+	cmd.PersistentFlags().StringVar(
+		&conflictPolicy,
+		"conflict-policy",
+		defaultConflictPolicy,
+		"Policy for names registered by containers of different compose services or images; one of \"first-wins\", \"last-wins\", \"round-robin\" or \"reject\".")
+
+	cmd.PersistentFlags().StringVar(
+		&nameTemplate,
+		"name-template",
+		defaultNameTemplate,
+		"Go text/template producing the sub-domains of a container, separated by commas or newlines, from its .Name, .ID, .Hostname, .Image, .Labels, .Compose and the label based .SubDomains of the .Domain.")
+
+	cmd.PersistentFlags().BoolVar(
+		&registerAll,
+		"register-all",
+		false,
+		"Register containers without a sub-domain as <container-name>.<domain-suffix>, sanitised.")
+
+	cmd.PersistentFlags().StringVar(
+		&registerExcludeLabel,
+		"register-exclude-label",
+		defaultRegisterExcludeLabel,
+		"Name of the label used to exclude a container from --register-all.")
+
+	cmd.PersistentFlags().StringVar(
+		&registerInclude,
+		"register-include",
+		"",
+		"Regular expression the container names registered by --register-all must match.")
+
+	cmd.PersistentFlags().StringVar(
+		&registerExclude,
+		"register-exclude",
+		"",
+		"Regular expression of container names not registered by --register-all.")
+
+	cmd.PersistentFlags().StringSliceVar(
+		&selector,
+		"selector",
+		nil,
+		"Label filters, as <key> or <key>=<value>, all of which the containers registered must match.")
+
+	cmd.PersistentFlags().DurationVar(
+		&reconcileInterval,
+		"reconcile-interval",
+		defaultReconcileInterval,
+		"Interval for reconciling records against running containers. Zero disables it.")
+
+	cmd.Flags().StringVar(
+		&backend,
+		"backend",
+		defaultBackend,
+		"Record backend to use; one of \"dnsmasq\", \"hosts\" or \"memory\".")
+
 	cmd.Flags().StringVar(
 		&dnsmasqHostsDirectory,
 		"dnsmasq-hostsdir",
 		defaultDnsmasqHostsDirectory,
 		"Directory for host entries to be written to which dnsmasq will read.")
 
+	cmd.Flags().StringVar(
+		&dnsmasqConfDirectory,
+		"dnsmasq-confdir",
+		defaultDnsmasqConfDirectory,
+		"Directory for the generated configuration, e.g. SRV records, to be written to which dnsmasq will read.")
+
 	cmd.Flags().StringVar(
 		&dnsmasqPidFile,
 		"dnsmasq-pidfile",
 		defaultDnsmasqPidFile,
 		"PID file of the dnsmasq process.")
 
+	cmd.Flags().StringVar(
+		&hostsFile,
+		"hosts-file",
+		defaultHostsFile,
+		"File to write host entries to when using the \"hosts\" backend.")
+
+	cmd.Flags().DurationVar(
+		&batchWindow,
+		"batch-window",
+		defaultBatchWindow,
+		"Window within which container changes are batched into a single reload.")
+
+	cmd.AddCommand(NewCmdDnsServe())
+
 	return cmd
 }
+
+// NewCmdDnsServe creates a new cobra.Command for the dns serve sub-command.
+func NewCmdDnsServe() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Runs ldhdns in DNS mode, answering queries itself instead of using dnsmasq",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := validateDomainSuffixes(); err != nil {
+				log.Fatal(err)
+			}
+			if err := dns.Serve(dnsConfig()); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&listenAddress,
+		"listen",
+		defaultListenAddress,
+		"Address to listen on for DNS queries (UDP and TCP).")
+
+	cmd.Flags().BoolVar(
+		&splitHorizon,
+		"split-horizon",
+		false,
+		"Answer queries with the addresses on the same network as the client, for clients on networks the DNS container is attached to.")
+
+	return cmd
+}
+
+func dnsConfig() dns.Config {
+	return dns.Config{
+		DomainSuffixes:       domainSuffixes,
+		SubDomainLabel:       subDomainLabel,
+		Backend:              backend,
+		HostsPath:            dnsmasqHostsDirectory,
+		ConfigPath:           dnsmasqConfDirectory,
+		HostsFile:            hostsFile,
+		PidFile:              dnsmasqPidFile,
+		ListenAddress:        listenAddress,
+		BatchWindow:          batchWindow,
+		ReconcileInterval:    reconcileInterval,
+		ComposeNames:         composeNames,
+		ComposeNumberedNames: composeNumberedNames,
+		ReplicaNames:         replicaNames,
+		NetworkLabel:         networkLabel,
+		PreferNetworks:       preferNetworks,
+		NetworkId:            networkId,
+		BridgeFirst:          bridgeFirst,
+		SplitHorizon:         splitHorizon,
+		SrvLabel:             srvLabel,
+		SrvExposedPorts:      srvExposedPorts,
+		CnameLabel:           cnameLabel,
+		WildcardLabel:        wildcardLabel,
+		TxtRecords:           txtRecords,
+		Upstreams:            upstreams,
+		DefaultTTL:           ttl,
+		TtlLabel:             ttlLabel,
+		NegativeTTL:          negativeTTL,
+		StaticRecordsFile:    staticRecordsFile,
+		HostName:             hostName,
+		HostGateways:         hostGateways,
+		ConflictPolicy:       conflictPolicy,
+		NameTemplate:         nameTemplate,
+		RegisterAll:          registerAll,
+		RegisterExcludeLabel: registerExcludeLabel,
+		RegisterInclude:      registerInclude,
+		RegisterExclude:      registerExclude,
+		Selector:             selector,
+	}
+}
@@ -1,7 +1,12 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/spf13/cobra"
+	"go.virtualstaticvoid.com/ldhdns/internal/dns"
 )
 
 const (
@@ -12,16 +17,66 @@ const (
 	defaultDnsmasqHostsDirectory = "/etc/ldhdns/dnsmasq/hosts.d"
 	defaultDnsmasqPidFile        = "/var/run/dnsmasq.pid"
 	defaultContainerName         = "ldhdns"
+	defaultListenAddress         = ":53"
+	defaultBackend               = dns.BackendDnsmasq
+	defaultHostsFile             = "/etc/ldhdns/hosts"
+	defaultBatchWindow           = 500 * time.Millisecond
+	defaultReconcileInterval     = time.Minute
+	defaultNetworkLabel          = "dns.ldh/network"
+	defaultSrvLabel              = "dns.ldh/srv"
+	defaultCnameLabel            = "dns.ldh/cname"
+	defaultWildcardLabel         = "dns.ldh/wildcard"
+	defaultTTL                   = 15
+	defaultNegativeTTL           = 15
+	defaultTtlLabel              = "dns.ldh/ttl"
+	defaultHostName              = "host"
+	defaultConflictPolicy        = dns.ConflictRoundRobin
+	defaultDnsmasqConfDirectory  = "/etc/ldhdns/dnsmasq/conf.d"
+	defaultNameTemplate          = dns.DefaultNameTemplate
+	defaultRegisterExcludeLabel  = "dns.ldh/exclude"
 )
 
 var (
 	// configuration variables
 	networkId             string
-	domainSuffix          string
+	domainSuffixes        []string
 	subDomainLabel        string
 	dnsmasqHostsDirectory string
 	dnsmasqPidFile        string
 	containerName         string
+	listenAddress         string
+	backend               string
+	hostsFile             string
+	batchWindow           time.Duration
+	reconcileInterval     time.Duration
+	embeddedDns           bool
+	composeNames          bool
+	composeNumberedNames  bool
+	replicaNames          bool
+	networkLabel          string
+	preferNetworks        []string
+	bridgeFirst           bool
+	splitHorizon          bool
+	srvLabel              string
+	srvExposedPorts       bool
+	cnameLabel            string
+	wildcardLabel         string
+	txtRecords            bool
+	upstreams             []string
+	ttl                   uint32
+	negativeTTL           uint32
+	ttlLabel              string
+	staticRecordsFile     string
+	hostName              string
+	hostGateways          []string
+	conflictPolicy        string
+	dnsmasqConfDirectory  string
+	nameTemplate          string
+	registerAll           bool
+	registerExcludeLabel  string
+	registerInclude       string
+	registerExclude       string
+	selector              []string
 
 	// Version can be set via:
 	// -ldflags="-X go.virtualstaticvoid.com/ldhdns/cmd.Version=$VERSION"
@@ -34,3 +89,18 @@ var (
 		Run:   func(cmd *cobra.Command, _ []string) { _ = cmd.Usage() },
 	}
 )
+
+// validateDomainSuffixes validates and normalizes the "<suffix>[=<label>]"
+// domain suffixes, e.g. lowercasing and converting unicode to punycode
+func validateDomainSuffixes() error {
+	for i, value := range domainSuffixes {
+		parts := strings.SplitN(value, "=", 2)
+		suffix, err := dns.NormalizeName(parts[0])
+		if err != nil {
+			return fmt.Errorf("invalid --domain-suffix %q: %s", value, err)
+		}
+		parts[0] = suffix
+		domainSuffixes[i] = strings.Join(parts, "=")
+	}
+	return nil
+}
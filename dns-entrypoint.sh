@@ -0,0 +1,34 @@
+#!/usr/bin/dumb-init /bin/sh
+set -e
+# set -x # debug
+
+# run in embedded dns mode
+exec ldhdns dns serve --domain-suffix "${LDHDNS_DOMAIN_SUFFIX}" \
+                      --subdomain-label "${LDHDNS_SUBDOMAIN_LABEL}" \
+                      --compose-names="${LDHDNS_COMPOSE_NAMES}" \
+                      --compose-numbered-names="${LDHDNS_COMPOSE_NUMBERED_NAMES}" \
+                      --replica-names="${LDHDNS_REPLICA_NAMES}" \
+                      --network-id "${LDHDNS_NETWORK_ID}" \
+                      --network-label "${LDHDNS_NETWORK_LABEL}" \
+                      --prefer-network "${LDHDNS_PREFER_NETWORK}" \
+                      --bridge-first="${LDHDNS_BRIDGE_FIRST}" \
+                      --srv-label "${LDHDNS_SRV_LABEL}" \
+                      --srv-exposed-ports="${LDHDNS_SRV_EXPOSED_PORTS}" \
+                      --cname-label "${LDHDNS_CNAME_LABEL}" \
+                      --wildcard-label "${LDHDNS_WILDCARD_LABEL}" \
+                      --txt-records="${LDHDNS_TXT_RECORDS}" \
+                      --upstream "${LDHDNS_UPSTREAM}" \
+                      --default-ttl "${LDHDNS_DEFAULT_TTL}" \
+                      --ttl-label "${LDHDNS_TTL_LABEL}" \
+                      --negative-ttl "${LDHDNS_NEGATIVE_TTL}" \
+                      --static-records "${LDHDNS_STATIC_RECORDS}" \
+                      --host-name "${LDHDNS_HOST_NAME}" \
+                      --host-gateway "${LDHDNS_HOST_GATEWAYS}" \
+                      --conflict-policy "${LDHDNS_CONFLICT_POLICY}" \
+                      --name-template "${LDHDNS_NAME_TEMPLATE}" \
+                      --register-all="${LDHDNS_REGISTER_ALL}" \
+                      --register-exclude-label "${LDHDNS_REGISTER_EXCLUDE_LABEL}" \
+                      --register-include "${LDHDNS_REGISTER_INCLUDE}" \
+                      --register-exclude "${LDHDNS_REGISTER_EXCLUDE}" \
+                      --selector "${LDHDNS_SELECTOR}" \
+                      --split-horizon="${LDHDNS_SPLIT_HORIZON}"
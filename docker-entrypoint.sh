@@ -10,4 +10,5 @@ sleep 1
 exec ldhdns controller --network-id "${LDHDNS_NETWORK_ID}" \
                        --domain-suffix "${LDHDNS_DOMAIN_SUFFIX}" \
                        --subdomain-label "${LDHDNS_SUBDOMAIN_LABEL}" \
-                       --container-name "${LDHDNS_CONTAINER_NAME}"
+                       --container-name "${LDHDNS_CONTAINER_NAME}" \
+                       --embedded-dns="${LDHDNS_EMBEDDED_DNS}"
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
@@ -15,6 +16,7 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -24,6 +26,8 @@ const (
 	dnsContainerLabelPrefix = "dns.ldh"
 	containerStopTimeout    = 30 * time.Second
 	dbusChannelBufferSize   = 10
+	minReconnectDelay       = time.Second
+	maxReconnectDelay       = time.Minute
 
 	dbusResolveInterface        = "org.freedesktop.resolve1"
 	dbusResolveManagerInterface = "org.freedesktop.resolve1.Manager"
@@ -39,13 +43,25 @@ const (
 	dbusPropertiesChangedSignal = "PropertiesChanged"
 )
 
+// Config holds the settings for running in controller mode.
+type Config struct {
+	NetworkId string
+	// DomainSuffixes are "<suffix>[=<label>]" values, where suffixes
+	// without their own label use SubDomainLabel
+	DomainSuffixes []string
+	SubDomainLabel string
+	ContainerName  string
+	EmbeddedDNS    bool
+}
+
 type server struct {
 	docker             *client.Client
 	ctx                context.Context
 	cancel             context.CancelFunc
 	networkId          string
-	domainSuffix       string
+	domainSuffixes     []string
 	subDomainLabel     string
+	embeddedDNS        bool
 	ownContainerId     string
 	ownContainer       *types.ContainerJSON
 	containerNetworkID string
@@ -55,15 +71,16 @@ type server struct {
 	linkObject         dbus.BusObject
 }
 
-func Run(networkId string, domainSuffix string, subDomainLabel string, containerName string) error {
+// Run starts the DNS container and configures resolved to use it.
+func Run(config Config) error {
 	log.Println("Starting...")
-	s, err := newServer(networkId, domainSuffix, subDomainLabel, containerName)
+	s, err := newServer(config)
 	if err != nil {
 		log.Println("Failed to start server: ", err)
 		return err
 	}
 
-	log.Printf("Configured for %q domain and %q container label.\n", domainSuffix, subDomainLabel)
+	log.Printf("Configured for %q domains and %q container label.\n", config.DomainSuffixes, config.SubDomainLabel)
 
 	log.Println("Starting DNS container...")
 	err = s.findOrCreateAndRunDNSContainer()
@@ -97,7 +114,7 @@ func Run(networkId string, domainSuffix string, subDomainLabel string, container
 	return nil
 }
 
-func newServer(networkId string, domainSuffix string, subDomainLabel string, containerName string) (*server, error) {
+func newServer(config Config) (*server, error) {
 	// connect to the docker API
 	docker, err := client.NewClientWithOpts(client.FromEnv)
 	if err != nil {
@@ -112,12 +129,13 @@ func newServer(networkId string, domainSuffix string, subDomainLabel string, con
 		docker:         docker,
 		ctx:            ctx,
 		cancel:         cancel,
-		networkId:      networkId,
-		domainSuffix:   domainSuffix,
-		subDomainLabel: subDomainLabel,
+		networkId:      config.NetworkId,
+		domainSuffixes: config.DomainSuffixes,
+		subDomainLabel: config.SubDomainLabel,
+		embeddedDNS:    config.EmbeddedDNS,
 	}
 
-	svr.ownContainerId, err = svr.findOwnContainerId(containerName)
+	svr.ownContainerId, err = svr.findOwnContainerId(config.ContainerName)
 	if err != nil {
 		log.Println("Failed to determine own container ID: ", err)
 		return nil, err
@@ -307,17 +325,35 @@ func (s *server) findOrCreateAndRunDNSContainer() error {
 			fmt.Sprintf("%s/%s", dnsContainerLabelPrefix, "controller-id"):   s.ownContainer.ID,
 			fmt.Sprintf("%s/%s", dnsContainerLabelPrefix, "controller-name"): s.ownContainer.Name[1:],
 			fmt.Sprintf("%s/%s", dnsContainerLabelPrefix, "network-id"):      s.networkId,
-			fmt.Sprintf("%s/%s", dnsContainerLabelPrefix, "domain-suffix"):   s.domainSuffix,
+			fmt.Sprintf("%s/%s", dnsContainerLabelPrefix, "domain-suffix"):   strings.Join(s.domainSuffixes, ","),
 			fmt.Sprintf("%s/%s", dnsContainerLabelPrefix, "subdomain-label"): s.subDomainLabel,
+			fmt.Sprintf("%s/%s", dnsContainerLabelPrefix, "embedded-dns"):    strconv.FormatBool(s.embeddedDNS),
+		}
+
+		// gateways for publishing the host name
+		hostGateways, err := s.hostGateways()
+		if err != nil {
+			log.Println("Failed to determine host gateways: ", err)
+			return err
 		}
 
+		env := append([]string{}, s.ownContainer.Config.Env...)
+		env = append(env, fmt.Sprintf("LDHDNS_HOST_GATEWAYS=%s", strings.Join(hostGateways, ",")))
+
 		config := &container.Config{
 			Image:      s.ownContainer.Config.Image,
 			Entrypoint: []string{"/init"}, // s6-overlay entrypoint
-			Env:        s.ownContainer.Config.Env,
+			Env:        env,
 			Labels:     labels,
 		}
 
+		// answer queries using the built-in DNS server instead of dnsmasq
+		// so no s6-overlay supervision is needed
+		// NB: like the s6 service, configured via the environment
+		if s.embeddedDNS {
+			config.Entrypoint = []string{"/usr/bin/dumb-init", "--", "dns-entrypoint.sh"}
+		}
+
 		// Note: needs CAP_NET_ADMIN capabilities
 		hostConfig := &container.HostConfig{
 			AutoRemove: true,
@@ -475,22 +511,99 @@ func (s *server) setLinkDNSAndRoutingDomain(address net.IP) (dbus.BusObject, err
 		return nil, fmt.Errorf("failed to set link DNS: %s", err)
 	}
 
+	// reverse lookups of container addresses are routed too
+	reverseDomains, err := s.reverseDomains()
+	if err != nil {
+		log.Println("Failed to determine reverse domains: ", err)
+		return nil, err
+	}
+	routingDomains := append(s.routingDomains(), reverseDomains...)
+
 	var domains []Domain
-	domains = append(domains, Domain{
-		Name:    s.domainSuffix,
-		Routing: true,
-	})
+	for _, domainSuffix := range routingDomains {
+		domains = append(domains, Domain{
+			Name:    domainSuffix,
+			Routing: true,
+		})
+	}
 
-	// update link with routing domain name
+	// update link with routing domain names
 	err = link.Call(dbusResolveSetDomainsMethod, callFlags, domains).Store()
 	if err != nil {
-		log.Printf("Failed to set link Domain %s: %s\n", s.domainSuffix, err)
+		log.Printf("Failed to set link Domains %q: %s\n", routingDomains, err)
 		return nil, fmt.Errorf("failed to set link Domain: %s", err)
 	}
 
 	return link, nil
 }
 
+// routingDomains returns the domain suffixes, without any label mapping
+func (s *server) routingDomains() []string {
+	var domainSuffixes []string
+	for _, domainSuffix := range s.domainSuffixes {
+		domainSuffixes = append(domainSuffixes, strings.SplitN(domainSuffix, "=", 2)[0])
+	}
+	return domainSuffixes
+}
+
+func (s *server) bridgeNetworks() ([]types.NetworkResource, error) {
+	options := types.NetworkListOptions{
+		Filters: filters.NewArgs(filters.Arg("driver", "bridge")),
+	}
+	networks, err := s.docker.NetworkList(s.ctx, options)
+	if err != nil {
+		log.Println("Failed to list networks: ", err)
+		return nil, err
+	}
+	return networks, nil
+}
+
+// hostGateways returns the "<network>=<ip>" gateways
+// of the docker bridge networks
+func (s *server) hostGateways() ([]string, error) {
+	networks, err := s.bridgeNetworks()
+	if err != nil {
+		return nil, err
+	}
+
+	var gateways []string
+	for _, nw := range networks {
+		for _, config := range nw.IPAM.Config {
+			if len(config.Gateway) > 0 {
+				gateways = append(gateways, fmt.Sprintf("%s=%s", nw.Name, config.Gateway))
+			}
+		}
+	}
+	return gateways, nil
+}
+
+// reverseDomains returns the in-addr.arpa and ip6.arpa domains
+// of the subnets of the docker bridge networks
+func (s *server) reverseDomains() ([]string, error) {
+	networks, err := s.bridgeNetworks()
+	if err != nil {
+		return nil, err
+	}
+
+	var domains []string
+	for _, nw := range networks {
+		for _, config := range nw.IPAM.Config {
+			_, subnet, err := net.ParseCIDR(config.Subnet)
+			if err != nil {
+				log.Printf("Failed to parse subnet %q of network %s: %s\n", config.Subnet, nw.Name, err)
+				continue
+			}
+			for _, zone := range reverseZones(subnet) {
+				if !contains(domains, zone) {
+					domains = append(domains, zone)
+				}
+			}
+		}
+	}
+
+	return domains, nil
+}
+
 func (s *server) runEventLoop() error {
 
 	// channel for system interrupts
@@ -503,8 +616,46 @@ func (s *server) runEventLoop() error {
 		return err
 	}
 
+	// channels for docker networks being created or removed
+	// so their reverse domains are routed
+	networkEvents, networkErrors := s.makeNetworkEventsChannel()
+
+	// reopens the network event stream when interrupted
+	var reconnect <-chan time.Time
+	delay := minReconnectDelay
+
 	for {
 		select {
+		case <-networkEvents:
+			log.Println("Re-applying DNS change for network change...")
+			err = s.applyDNSConfiguration()
+			if err != nil {
+				log.Println("Failed to apply DNS change: ", err)
+				return err
+			}
+		case err := <-networkErrors:
+			// e.g. the docker daemon was restarted
+			log.Println("Network event stream interrupted: ", err)
+			log.Printf("Reconnecting in %s...\n", delay)
+			networkEvents, networkErrors = nil, nil
+			reconnect = time.After(delay)
+		case <-reconnect:
+			reconnect = nil
+			networkEvents, networkErrors = s.makeNetworkEventsChannel()
+
+			// catch up on networks created or removed whilst disconnected
+			log.Println("Re-applying DNS change after reconnecting...")
+			err = s.applyDNSConfiguration()
+			if err != nil {
+				// the stream is most likely interrupted again too
+				log.Println("Failed to apply DNS change: ", err)
+				delay *= 2
+				if delay > maxReconnectDelay {
+					delay = maxReconnectDelay
+				}
+				continue
+			}
+			delay = minReconnectDelay
 		case <-systemEvents:
 			log.Println("Re-applying DNS change...")
 			// re-apply DNS configuration after system resume
@@ -521,11 +672,20 @@ func (s *server) runEventLoop() error {
 }
 
 func (s *server) makeInterruptChannel() chan os.Signal {
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 	return c
 }
 
+func (s *server) makeNetworkEventsChannel() (<-chan events.Message, <-chan error) {
+	filter := filters.NewArgs(
+		filters.Arg("type", events.NetworkEventType),
+		filters.Arg("event", "create"),
+		filters.Arg("event", "destroy"),
+	)
+	return s.docker.Events(s.ctx, types.EventsOptions{Filters: filter})
+}
+
 func (s *server) makeSystemEventsChannel() (chan bool, error) {
 	// see BecomeMonitor for interface details
 	// https://dbus.freedesktop.org/doc/dbus-specification.html#bus-messages-become-monitor
@@ -744,3 +904,53 @@ func signalMatchRule(options ...matchOption) string {
 	}
 	return strings.Join(items, ",")
 }
+
+// reverseZones returns the reverse lookup zones of the subnet, rounding the prefix
+// length up to the next octet (IPv4) or nibble (IPv6) boundary so that no
+// addresses outside the subnet are included, e.g. the 16 zones from
+// 16.168.192.in-addr.arpa to 31.168.192.in-addr.arpa for 192.168.16.0/20
+func reverseZones(subnet *net.IPNet) []string {
+	ones, bits := subnet.Mask.Size()
+	ip, step, suffix := subnet.IP.To4(), 8, "in-addr.arpa"
+	if ip == nil {
+		ip, step, suffix = subnet.IP.To16(), 4, "ip6.arpa"
+	}
+
+	prefix := (ones + step - 1) / step * step
+	if prefix == 0 || prefix > bits {
+		return nil
+	}
+
+	var zones []string
+	for i := 0; i < 1<<uint(prefix-ones); i++ {
+		// set the bits between the prefix lengths
+		address := make(net.IP, len(ip))
+		copy(address, ip)
+		for b := 0; b < prefix-ones; b++ {
+			if i>>uint(b)&1 == 1 {
+				pos := prefix - 1 - b
+				address[pos/8] |= 0x80 >> uint(pos%8)
+			}
+		}
+
+		var labels []string
+		for n := prefix/step - 1; n >= 0; n-- {
+			if step == 8 {
+				labels = append(labels, strconv.Itoa(int(address[n])))
+			} else {
+				labels = append(labels, strconv.FormatInt(int64(address[n/2]>>uint(4*(1-n%2))&0xf), 16))
+			}
+		}
+		zones = append(zones, strings.Join(append(labels, suffix), "."))
+	}
+	return zones
+}
+
+func contains(items []string, item string) bool {
+	for _, existing := range items {
+		if existing == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestReverseZones(t *testing.T) {
+	tests := []struct {
+		subnet string
+		// the number of zones, and the first and last of them
+		count int
+		first string
+		last  string
+	}{
+		{subnet: "10.0.0.0/8", count: 1, first: "10.in-addr.arpa", last: "10.in-addr.arpa"},
+		{subnet: "172.30.0.0/16", count: 1, first: "30.172.in-addr.arpa", last: "30.172.in-addr.arpa"},
+		{subnet: "192.168.1.0/24", count: 1, first: "1.168.192.in-addr.arpa", last: "1.168.192.in-addr.arpa"},
+		{subnet: "172.16.0.0/12", count: 16, first: "16.172.in-addr.arpa", last: "31.172.in-addr.arpa"},
+		{subnet: "192.168.16.0/20", count: 16, first: "16.168.192.in-addr.arpa", last: "31.168.192.in-addr.arpa"},
+		{subnet: "192.168.1.128/25", count: 128, first: "128.1.168.192.in-addr.arpa", last: "255.1.168.192.in-addr.arpa"},
+		{subnet: "0.0.0.0/0", count: 0},
+		{subnet: "fd00:1::/64", count: 1,
+			first: "0.0.0.0.0.0.0.0.1.0.0.0.0.0.d.f.ip6.arpa",
+			last:  "0.0.0.0.0.0.0.0.1.0.0.0.0.0.d.f.ip6.arpa"},
+		{subnet: "fd00:1::/62", count: 4,
+			first: "0.0.0.0.0.0.0.0.1.0.0.0.0.0.d.f.ip6.arpa",
+			last:  "3.0.0.0.0.0.0.0.1.0.0.0.0.0.d.f.ip6.arpa"},
+		{subnet: "2001:db8::/32", count: 1, first: "8.b.d.0.1.0.0.2.ip6.arpa", last: "8.b.d.0.1.0.0.2.ip6.arpa"},
+		{subnet: "fe80::/10", count: 4, first: "8.e.f.ip6.arpa", last: "b.e.f.ip6.arpa"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.subnet, func(t *testing.T) {
+			_, subnet, err := net.ParseCIDR(test.subnet)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			zones := reverseZones(subnet)
+			if len(zones) != test.count {
+				t.Fatalf("got %d zones %v, expected %d", len(zones), zones, test.count)
+			}
+			if test.count == 0 {
+				return
+			}
+			if zones[0] != test.first || zones[len(zones)-1] != test.last {
+				t.Errorf("got %q to %q, expected %q to %q", zones[0], zones[len(zones)-1], test.first, test.last)
+			}
+
+			// each zone only once
+			seen := make(map[string]bool)
+			for _, zone := range zones {
+				if seen[zone] {
+					t.Errorf("zone %q repeated", zone)
+				}
+				seen[zone] = true
+			}
+		})
+	}
+}
+
+func TestReverseZonesOfSmallSubnet(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.0.0.4/30")
+	expected := []string{
+		"4.0.0.10.in-addr.arpa",
+		"5.0.0.10.in-addr.arpa",
+		"6.0.0.10.in-addr.arpa",
+		"7.0.0.10.in-addr.arpa",
+	}
+
+	zones := reverseZones(subnet)
+	if !reflect.DeepEqual(zones, expected) {
+		t.Errorf("got %v, expected %v", zones, expected)
+	}
+}
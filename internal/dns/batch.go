@@ -0,0 +1,53 @@
+package dns
+
+import (
+	"log"
+	"time"
+)
+
+// changed records a change made to the record sink and schedules
+// a commit, so that changes made within the batch window are
+// applied together with a single reload of the resolver
+func (s *server) changed() {
+	// NOTE: must be called with the lock held
+	s.pendingChanges++
+
+	if s.batchWindow <= 0 {
+		s.commitPending()
+		return
+	}
+
+	if s.commitTimer == nil {
+		s.commitTimer = time.AfterFunc(s.batchWindow, s.commit)
+	}
+}
+
+func (s *server) commit() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.commitPending()
+}
+
+func (s *server) commitPending() {
+	// NOTE: must be called with the lock held
+	if s.commitTimer != nil {
+		s.commitTimer.Stop()
+		s.commitTimer = nil
+	}
+
+	if s.pendingChanges == 0 {
+		return
+	}
+
+	changes := s.pendingChanges
+	s.pendingChanges = 0
+
+	err := s.sink.Commit()
+	if err != nil {
+		log.Printf("Error applying %d change(s): %s\n", changes, err)
+		return
+	}
+
+	log.Printf("Applied %d batched change(s)\n", changes)
+}
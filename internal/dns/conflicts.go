@@ -0,0 +1,289 @@
+package dns
+
+import (
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+)
+
+const (
+	// ConflictFirstWins keeps a name with the container which started first
+	ConflictFirstWins = "first-wins"
+	// ConflictLastWins moves a name to the container which started last
+	ConflictLastWins = "last-wins"
+	// ConflictRoundRobin publishes a name for all the containers
+	ConflictRoundRobin = "round-robin"
+	// ConflictReject doesn't register containers with names already taken
+	ConflictReject = "reject"
+)
+
+// claim is a container's claim on its names, before conflicts with the
+// names of other containers are resolved
+type claim struct {
+	entry Entry
+	// owner identifies the application of the container, so that
+	// replicas of the same application don't conflict
+	owner   string
+	started time.Time
+}
+
+// conflict is a name lost by a container
+type conflict struct {
+	name        string
+	containerID string
+}
+
+func parseConflictPolicy(value string) (string, error) {
+	switch value {
+	case ConflictFirstWins, ConflictLastWins, ConflictRoundRobin, ConflictReject:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q", value)
+}
+
+// containerOwner returns the compose project and service of the
+// container, or otherwise it's image
+func containerOwner(meta types.ContainerJSON) string {
+	project := meta.Config.Labels[composeProjectLabel]
+	service := meta.Config.Labels[composeServiceLabel]
+	if len(project) > 0 && len(service) > 0 {
+		return fmt.Sprintf("compose %s/%s", project, service)
+	}
+	return fmt.Sprintf("image %s", meta.Config.Image)
+}
+
+func (s *server) register(entry Entry, owner string, started time.Time) error {
+	// NOTE: must be called with the lock held
+
+	s.claims[entry.ContainerID] = claim{
+		entry:   entry,
+		owner:   owner,
+		started: started,
+	}
+
+	return s.resolveClaims()
+}
+
+// resolveClaims applies the conflict policy to the names claimed by more
+// than one application, and updates the records of the containers whose
+// published names changed as a result
+func (s *server) resolveClaims() error {
+	// NOTE: must be called with the lock held
+
+	// ordered by start time, i.e. first come first served
+	containerIDs := make([]string, 0, len(s.claims))
+	for containerID := range s.claims {
+		containerIDs = append(containerIDs, containerID)
+	}
+	sort.Slice(containerIDs, func(i, j int) bool {
+		a, b := s.claims[containerIDs[i]], s.claims[containerIDs[j]]
+		if !a.started.Equal(b.started) {
+			return a.started.Before(b.started)
+		}
+		return containerIDs[i] < containerIDs[j]
+	})
+
+	claimants := make(map[string][]string)
+	var names []string
+	for _, containerID := range containerIDs {
+		for _, hostName := range s.claims[containerID].entry.HostNames {
+			name := canonicalName(hostName)
+			if _, ok := claimants[name]; !ok {
+				names = append(names, name)
+			}
+			claimants[name] = append(claimants[name], containerID)
+		}
+	}
+
+	lost := make(map[string]map[string]struct{})
+	rejected := s.rejectedClaims(containerIDs)
+	annotations := make(map[string][]string)
+	conflicts := make(map[conflict]struct{})
+
+	for _, name := range names {
+		containers := claimants[name]
+
+		// rejected containers don't keep names from others
+		var candidates []string
+		for _, containerID := range containers {
+			if _, isRejected := rejected[containerID]; !isRejected {
+				candidates = append(candidates, containerID)
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+
+		// the application keeping the name
+		winner := s.claims[candidates[0]].owner
+		if s.conflictPolicy == ConflictLastWins {
+			winner = s.claims[candidates[len(candidates)-1]].owner
+		}
+
+		var winners, losers []string
+		for _, containerID := range containers {
+			_, isRejected := rejected[containerID]
+			if s.claims[containerID].owner == winner && !isRejected {
+				winners = append(winners, containerID)
+			} else {
+				losers = append(losers, containerID)
+			}
+		}
+
+		// replicas of the same application
+		if len(losers) == 0 {
+			continue
+		}
+
+		for _, containerID := range losers {
+			c := conflict{name: name, containerID: containerID}
+			conflicts[c] = struct{}{}
+
+			// logged once, when the conflict arises
+			_, known := s.conflicts[c]
+
+			if s.conflictPolicy == ConflictRoundRobin {
+				if !known {
+					log.Printf("[%s] Name %q is also registered by %s (%s); publishing both\n", containerID, name, winners[0], winner)
+				}
+				continue
+			}
+
+			if !known {
+				log.Printf("[%s] Name %q conflicts with %s (%s); not published for %s due to %q policy\n", containerID, name, winners[0], winner, s.claims[containerID].owner, s.conflictPolicy)
+			}
+
+			if s.conflictPolicy != ConflictReject {
+				if lost[containerID] == nil {
+					lost[containerID] = make(map[string]struct{})
+				}
+				lost[containerID][name] = struct{}{}
+			}
+
+			// annotated, so the loser can be found from the name
+			for _, containerID := range winners {
+				annotations[containerID] = append(annotations[containerID],
+					fmt.Sprintf("conflict=%s lost by %s (%s)", name, shortID(c.containerID), s.claims[c.containerID].owner))
+			}
+		}
+	}
+	s.conflicts = conflicts
+
+	for _, containerID := range containerIDs {
+		entry := s.claims[containerID].entry
+		if lostNames, ok := lost[containerID]; ok {
+			entry = withoutNames(entry, lostNames)
+		}
+		if len(annotations[containerID]) > 0 {
+			entry.Text = append(append([]string{}, entry.Text...), annotations[containerID]...)
+		}
+
+		_, isRejected := rejected[containerID]
+		err := s.publish(containerID, entry, !isRejected && len(entry.HostNames) > 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	// static records may no longer conflict, or conflict now
+	return s.applyStaticRecords()
+}
+
+// rejectedClaims returns the containers rejected by the reject policy,
+// i.e. those claiming a name already kept by a container of another
+// application which started before them and wasn't itself rejected
+func (s *server) rejectedClaims(containerIDs []string) map[string]struct{} {
+	rejected := make(map[string]struct{})
+	if s.conflictPolicy != ConflictReject {
+		return rejected
+	}
+
+	// ordered by start time, i.e. first come first served
+	owners := make(map[string]string)
+	for _, containerID := range containerIDs {
+		c := s.claims[containerID]
+
+		accepted := true
+		for _, hostName := range c.entry.HostNames {
+			if owner, ok := owners[canonicalName(hostName)]; ok && owner != c.owner {
+				accepted = false
+				break
+			}
+		}
+		if !accepted {
+			rejected[containerID] = struct{}{}
+			continue
+		}
+
+		for _, hostName := range c.entry.HostNames {
+			owners[canonicalName(hostName)] = c.owner
+		}
+	}
+	return rejected
+}
+
+// publish updates the records of the container, if they changed
+func (s *server) publish(containerID string, entry Entry, ok bool) error {
+	// NOTE: must be called with the lock held
+
+	published, isPublished := s.published[containerID]
+	if !ok {
+		if !isPublished {
+			return nil
+		}
+
+		err := s.sink.Remove(containerID)
+		if err != nil {
+			return err
+		}
+		delete(s.published, containerID)
+		delete(s.registered, containerID)
+		s.changed()
+		return nil
+	}
+
+	if isPublished && reflect.DeepEqual(published, entry) {
+		return nil
+	}
+
+	err := s.sink.Add(entry)
+	if err != nil {
+		return err
+	}
+	s.published[containerID] = entry
+	s.registered[containerID] = entry.HostNames
+	s.changed()
+	return nil
+}
+
+// withoutNames returns the entry without the host names
+// and the aliases of the host names
+func withoutNames(entry Entry, names map[string]struct{}) Entry {
+	var hostNames []string
+	for _, hostName := range entry.HostNames {
+		if _, ok := names[canonicalName(hostName)]; !ok {
+			hostNames = append(hostNames, hostName)
+		}
+	}
+
+	var aliases []Alias
+	for _, alias := range entry.Aliases {
+		if _, ok := names[canonicalName(alias.Name)]; !ok {
+			aliases = append(aliases, alias)
+		}
+	}
+
+	entry.HostNames = hostNames
+	entry.Aliases = aliases
+	return entry
+}
+
+func shortID(containerID string) string {
+	if len(containerID) > 12 {
+		return containerID[:12]
+	}
+	return containerID
+}
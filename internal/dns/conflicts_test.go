@@ -0,0 +1,133 @@
+package dns
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestResolveClaims(t *testing.T) {
+	started := time.Date(2023, 1, 29, 10, 0, 0, 0, time.UTC)
+
+	// containers started in the order given
+	type container struct {
+		id        string
+		owner     string
+		hostNames []string
+	}
+
+	tests := []struct {
+		name       string
+		policy     string
+		containers []container
+		// published host names of each container
+		expected map[string][]string
+	}{
+		{
+			name:   "replicas share names",
+			policy: ConflictReject,
+			containers: []container{
+				{id: "a1", owner: "compose shop/api", hostNames: []string{"api.ldh.dns"}},
+				{id: "a2", owner: "compose shop/api", hostNames: []string{"api.ldh.dns"}},
+			},
+			expected: map[string][]string{
+				"a1": {"api.ldh.dns"},
+				"a2": {"api.ldh.dns"},
+			},
+		},
+		{
+			name:   "round robin publishes both",
+			policy: ConflictRoundRobin,
+			containers: []container{
+				{id: "a", owner: "image nginx", hostNames: []string{"api.ldh.dns"}},
+				{id: "b", owner: "image httpd", hostNames: []string{"api.ldh.dns"}},
+			},
+			expected: map[string][]string{
+				"a": {"api.ldh.dns"},
+				"b": {"api.ldh.dns"},
+			},
+		},
+		{
+			name:   "first wins",
+			policy: ConflictFirstWins,
+			containers: []container{
+				{id: "a", owner: "image nginx", hostNames: []string{"api.ldh.dns"}},
+				{id: "b", owner: "image httpd", hostNames: []string{"api.ldh.dns", "web.ldh.dns"}},
+			},
+			expected: map[string][]string{
+				"a": {"api.ldh.dns"},
+				"b": {"web.ldh.dns"},
+			},
+		},
+		{
+			name:   "last wins",
+			policy: ConflictLastWins,
+			containers: []container{
+				{id: "a", owner: "image nginx", hostNames: []string{"api.ldh.dns", "web.ldh.dns"}},
+				{id: "b", owner: "image httpd", hostNames: []string{"api.ldh.dns"}},
+			},
+			expected: map[string][]string{
+				"a": {"web.ldh.dns"},
+				"b": {"api.ldh.dns"},
+			},
+		},
+		{
+			name:   "reject drops all names of the later container",
+			policy: ConflictReject,
+			containers: []container{
+				{id: "a", owner: "image nginx", hostNames: []string{"api.ldh.dns"}},
+				{id: "b", owner: "image httpd", hostNames: []string{"api.ldh.dns", "web.ldh.dns"}},
+			},
+			expected: map[string][]string{
+				"a": {"api.ldh.dns"},
+			},
+		},
+		{
+			name:   "rejected containers don't keep names from others",
+			policy: ConflictReject,
+			containers: []container{
+				{id: "a", owner: "image nginx", hostNames: []string{"api.ldh.dns"}},
+				{id: "b", owner: "image httpd", hostNames: []string{"web.ldh.dns", "api.ldh.dns"}},
+				{id: "c", owner: "image caddy", hostNames: []string{"web.ldh.dns"}},
+			},
+			expected: map[string][]string{
+				"a": {"api.ldh.dns"},
+				"c": {"web.ldh.dns"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &server{
+				sink:            newRecordTable(),
+				registered:      make(map[string][]string),
+				claims:          make(map[string]claim),
+				published:       make(map[string]Entry),
+				conflicts:       make(map[conflict]struct{}),
+				conflictPolicy:  test.policy,
+				staticApplied:   make(map[string]struct{}),
+				staticConflicts: make(map[string]struct{}),
+			}
+
+			for i, c := range test.containers {
+				entry := Entry{ContainerID: c.id, HostNames: c.hostNames}
+				err := s.register(entry, c.owner, started.Add(time.Duration(i)*time.Second))
+				if err != nil {
+					t.Fatalf("register %s: %s", c.id, err)
+				}
+			}
+
+			actual := make(map[string][]string)
+			for containerID, entry := range s.published {
+				hostNames := append([]string{}, entry.HostNames...)
+				sort.Strings(hostNames)
+				actual[containerID] = hostNames
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("published %v, expected %v", actual, test.expected)
+			}
+		})
+	}
+}
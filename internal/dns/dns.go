@@ -2,59 +2,275 @@ package dns
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
+	miekg "github.com/miekg/dns"
 	"io"
-	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
+	"text/template"
+	"time"
 )
 
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+// Config holds the settings for running in DNS mode.
+type Config struct {
+	// DomainSuffixes are "<suffix>[=<label>]" values, where suffixes
+	// without their own label use SubDomainLabel
+	DomainSuffixes []string
+	SubDomainLabel string
+	Backend        string
+	HostsPath      string
+	// ConfigPath is the directory for the generated dnsmasq configuration
+	ConfigPath    string
+	HostsFile     string
+	PidFile       string
+	ListenAddress string
+	BatchWindow   time.Duration
+	// ReconcileInterval of zero disables periodic reconciliation
+	ReconcileInterval time.Duration
+	// ComposeNames derives names for containers without a label
+	// from their docker compose project and service labels
+	ComposeNames         bool
+	ComposeNumberedNames bool
+	// ReplicaNames additionally registers "<replica>.<name>" for each name
+	ReplicaNames bool
+	// NetworkLabel is the label containers use to restrict the
+	// network(s) whose addresses are published
+	NetworkLabel   string
+	PreferNetworks []string
+	// NetworkId is the managed bridge network, published
+	// first for containers attached to it when BridgeFirst
+	NetworkId   string
+	BridgeFirst bool
+	// SplitHorizon answers queries with the addresses on the same
+	// network as the client, when serving queries, which is only
+	// known for clients on networks the DNS container is attached to
+	SplitHorizon bool
+	// SrvLabel is the label containers use to provide
+	// "_<service>._<proto>:<port>" SRV records
+	SrvLabel string
+	// SrvExposedPorts publishes SRV records for exposed ports
+	SrvExposedPorts bool
+	// CnameLabel is the label containers use to publish their
+	// names as aliases of another name, instead of addresses
+	CnameLabel string
+	// WildcardLabel is the label containers use to also publish
+	// their records for any name within their names
+	WildcardLabel string
+	// TxtRecords publishes the container metadata as TXT records
+	TxtRecords bool
+	// Upstreams are the "<ip>[:<port>]" DNS servers queries outside
+	// of the domains are forwarded to, instead of the system resolver
+	// for dnsmasq, or refused by the embedded server when none
+	Upstreams []string
+	// DefaultTTL of records, in seconds, unless given by the TtlLabel
+	DefaultTTL uint32
+	TtlLabel   string
+	// NegativeTTL is the time, in seconds, for which resolvers cache
+	// the absence of a name (or record type) within the domains; dnsmasq
+	// only applies it to upstream answers without an SOA record
+	NegativeTTL uint32
+	// StaticRecordsFile is a hosts file of records merged with those of
+	// the containers, which win when both have the same name
+	StaticRecordsFile string
+	// HostName is published within each domain for the gateways,
+	// given as "<network>=<ip>" HostGateways, unless empty
+	HostName     string
+	HostGateways []string
+	// ConflictPolicy determines which containers publish a name claimed
+	// by containers of different applications, i.e. compose services or
+	// images; one of "first-wins", "last-wins", "round-robin" or "reject"
+	ConflictPolicy string
+	// NameTemplate is a text/template producing the sub-domains of a
+	// container for each domain, DefaultNameTemplate when empty
+	NameTemplate string
+	// RegisterAll registers containers without names as their
+	// sanitised container name, unless they have a truthy
+	// RegisterExcludeLabel, or their name doesn't match the
+	// RegisterInclude or matches the RegisterExclude pattern
+	RegisterAll          bool
+	RegisterExcludeLabel string
+	RegisterInclude      string
+	RegisterExclude      string
+	// Selector are "<key>[=<value>]" label filters, all of which the
+	// containers must match to be registered
+	Selector []string
+}
+
 type server struct {
-	lock           sync.RWMutex
-	docker         *client.Client
-	ctx            context.Context
-	domainSuffix   string
-	subDomainLabel string
-	hostsPath      string
-	pidFile        string
+	lock                 sync.RWMutex
+	docker               *client.Client
+	ctx                  context.Context
+	domains              []domain
+	composeNames         bool
+	composeNumberedNames bool
+	replicaNames         bool
+	networkLabel         string
+	preferNetworks       []string
+	networkId            string
+	bridgeFirst          bool
+	sink                 RecordSink
+	registered           map[string][]string // host names published for each container
+	claims               map[string]claim
+	published            map[string]Entry
+	conflicts            map[conflict]struct{}
+	conflictPolicy       string
+	batchWindow          time.Duration
+	pendingChanges       int
+	commitTimer          *time.Timer
+	reconcileInterval    time.Duration
+	records              *recordTable
+	listeners            []*miekg.Server
+	rotation             uint32
+	splitHorizon         bool
+	networks             networkTable
+	srvLabel             string
+	srvExposedPorts      bool
+	cnameLabel           string
+	wildcardLabel        string
+	txtRecords           bool
+	upstreams            []string
+	defaultTTL           uint32
+	ttlLabel             string
+	negativeTTL          uint32
+	staticRecordsFile    string
+	staticRecords        []Entry
+	staticApplied        map[string]struct{}
+	staticConflicts      map[string]struct{}
+	hostName             string
+	hostGateways         []Address
+	gatewayRecords       []Entry
+	nameTemplate         *template.Template
+	templatedNames       bool // names don't only come from labels
+	registerAll          bool
+	registerExcludeLabel string
+	registerInclude      *regexp.Regexp
+	registerExclude      *regexp.Regexp
+	selector             filters.Args
+}
+
+// Run writes container records to the configured backend.
+func Run(config Config) error {
+	log.Println("Starting...")
+	server, err := newServer(config)
+	if err != nil {
+		log.Println("Failed to start server: ", err)
+		return err
+	}
+
+	server.sink, err = newRecordSink(config, server.domains, server.upstreams)
+	if err != nil {
+		log.Println("Failed to create record backend: ", err)
+		return err
+	}
+
+	log.Printf("Using %q record backend.\n", config.Backend)
+
+	// e.g. the options of dnsmasq, before any containers are registered
+	err = server.sink.Commit()
+	if err != nil {
+		log.Println("Failed to initialise record backend: ", err)
+		return err
+	}
+
+	if config.Backend == BackendHostsFile {
+		log.Println("NOTE: SRV, CNAME, TXT and wildcard records, and TTLs, can't be published with the \"hosts\" record backend.")
+	}
+
+	return server.run()
 }
 
-func Run(domainSuffix string, subDomainLabel string, hostsPath string, pidFile string) error {
+// Serve answers DNS queries itself from an in-memory record table.
+func Serve(config Config) error {
 	log.Println("Starting...")
-	server, err := newServer(domainSuffix, subDomainLabel, hostsPath, pidFile)
+	server, err := newServer(config)
 	if err != nil {
 		log.Println("Failed to start server: ", err)
 		return err
 	}
+	server.records = newRecordTable()
+	server.sink = server.records
+	server.splitHorizon = config.SplitHorizon
 
-	log.Printf("Configured for %q domain and %q container label.\n", domainSuffix, subDomainLabel)
+	// for split horizon answers and reverse lookups
+	log.Println("Loading networks...")
+	err = server.refreshNetworks()
+	if err != nil {
+		log.Println("Failed to load networks: ", err)
+		return err
+	}
+
+	log.Printf("Listening on %q...\n", config.ListenAddress)
+	err = server.listenAndServe(config.ListenAddress)
+	if err != nil {
+		log.Println("Failed to start DNS listener: ", err)
+		return err
+	}
+
+	return server.run()
+}
+
+// servesQueries determines whether queries are answered from the
+// records, rather than by a backend, so networks are tracked too
+func (s *server) servesQueries() bool {
+	return s.records != nil
+}
+
+func (s *server) run() error {
+	if len(s.staticRecordsFile) > 0 {
+		log.Printf("Loading static records from %q...\n", s.staticRecordsFile)
+		err := s.loadStaticRecords()
+		if err != nil {
+			log.Println("Failed to load static records: ", err)
+			return err
+		}
+	}
+
+	err := s.updateHostGateway()
+	if err != nil {
+		log.Println("Failed to publish host gateway: ", err)
+		return err
+	}
+
+	// events from the start of loading onwards, so containers
+	// started whilst loading aren't missed
+	since := time.Now()
 
 	log.Println("Loading existing containers...")
-	err = server.loadRunningContainers()
+	err = s.loadRunningContainers()
 	if err != nil {
 		log.Println("Failed to load existing containers: ", err)
 		return err
 	}
 
+	log.Println("Running reconciliation loop...")
+	s.runReconcileLoop()
+
 	log.Println("Running event loop...")
-	err = server.runEventLoop()
+	err = s.runEventLoop(since)
 	if err != nil {
 		log.Println("Failed to run event loop: ", err)
 		return err
 	}
 
 	log.Println("Shutting down...")
-	err = server.close()
+	err = s.close()
 	if err != nil {
 		log.Println("Failed shutdown: ", err)
 		return err
@@ -64,7 +280,74 @@ func Run(domainSuffix string, subDomainLabel string, hostsPath string, pidFile s
 	return nil
 }
 
-func newServer(domainSuffix string, subDomainLabel string, hostsPath string, pidFile string) (*server, error) {
+func newServer(config Config) (*server, error) {
+	domains, err := parseDomains(config.DomainSuffixes, config.SubDomainLabel)
+	if err != nil {
+		log.Println("Invalid domain configuration: ", err)
+		return nil, err
+	}
+
+	for _, d := range domains {
+		log.Printf("Configured for %s.\n", d)
+	}
+
+	upstreams, err := parseUpstreams(config.Upstreams)
+	if err != nil {
+		log.Println("Invalid upstream configuration: ", err)
+		return nil, err
+	}
+
+	if len(upstreams) > 0 {
+		log.Printf("Forwarding other queries to %q.\n", upstreams)
+	}
+
+	hostGateways, err := parseHostGateways(config.HostGateways)
+	if err != nil {
+		log.Println("Invalid host gateway configuration: ", err)
+		return nil, err
+	}
+
+	if len(config.HostName) > 0 {
+		if _, err := NormalizeName(config.HostName); err != nil {
+			log.Println("Invalid host name: ", err)
+			return nil, err
+		}
+	}
+
+	conflictPolicy, err := parseConflictPolicy(config.ConflictPolicy)
+	if err != nil {
+		log.Println("Invalid conflict policy: ", err)
+		return nil, err
+	}
+
+	nameTemplate, err := parseNameTemplate(config.NameTemplate)
+	if err != nil {
+		log.Println("Invalid name template: ", err)
+		return nil, err
+	}
+
+	registerInclude, err := parseNamePattern(config.RegisterInclude)
+	if err != nil {
+		log.Println("Invalid register include pattern: ", err)
+		return nil, err
+	}
+
+	registerExclude, err := parseNamePattern(config.RegisterExclude)
+	if err != nil {
+		log.Println("Invalid register exclude pattern: ", err)
+		return nil, err
+	}
+
+	selector, err := parseSelector(config.Selector)
+	if err != nil {
+		log.Println("Invalid selector: ", err)
+		return nil, err
+	}
+
+	if selector.Len() > 0 {
+		log.Printf("Serving containers matching %q.\n", selector.Get("label"))
+	}
+
 	// connect to the docker API - uses DOCKER_HOST environment variable
 	docker, err := client.NewClientWithOpts(client.FromEnv)
 	if err != nil {
@@ -78,21 +361,59 @@ func newServer(domainSuffix string, subDomainLabel string, hostsPath string, pid
 
 	// create variable to hold server state
 	return &server{
-		docker:         docker,
-		ctx:            ctx,
-		domainSuffix:   domainSuffix,
-		subDomainLabel: subDomainLabel,
-		hostsPath:      hostsPath,
-		pidFile:        pidFile,
+		docker:               docker,
+		ctx:                  ctx,
+		domains:              domains,
+		composeNames:         config.ComposeNames,
+		composeNumberedNames: config.ComposeNumberedNames,
+		replicaNames:         config.ReplicaNames,
+		networkLabel:         config.NetworkLabel,
+		preferNetworks:       config.PreferNetworks,
+		networkId:            config.NetworkId,
+		bridgeFirst:          config.BridgeFirst,
+		registered:           make(map[string][]string),
+		claims:               make(map[string]claim),
+		published:            make(map[string]Entry),
+		conflicts:            make(map[conflict]struct{}),
+		conflictPolicy:       conflictPolicy,
+		batchWindow:          config.BatchWindow,
+		reconcileInterval:    config.ReconcileInterval,
+		srvLabel:             config.SrvLabel,
+		srvExposedPorts:      config.SrvExposedPorts,
+		cnameLabel:           config.CnameLabel,
+		wildcardLabel:        config.WildcardLabel,
+		txtRecords:           config.TxtRecords,
+		upstreams:            upstreams,
+		defaultTTL:           config.DefaultTTL,
+		ttlLabel:             config.TtlLabel,
+		negativeTTL:          config.NegativeTTL,
+		staticRecordsFile:    config.StaticRecordsFile,
+		staticApplied:        make(map[string]struct{}),
+		staticConflicts:      make(map[string]struct{}),
+		hostName:             config.HostName,
+		hostGateways:         hostGateways,
+		nameTemplate:         nameTemplate,
+		templatedNames:       len(strings.TrimSpace(config.NameTemplate)) > 0 && config.NameTemplate != DefaultNameTemplate,
+		registerAll:          config.RegisterAll,
+		registerExcludeLabel: config.RegisterExcludeLabel,
+		registerInclude:      registerInclude,
+		registerExclude:      registerExclude,
+		selector:             selector,
 	}, nil
 }
 
 func (s *server) close() error {
+	// apply any outstanding changes
+	s.commit()
+
+	if s.records != nil {
+		s.shutdownListeners()
+	}
 	return s.docker.Close()
 }
 
 func (s *server) loadRunningContainers() error {
-	containerList, err := s.docker.ContainerList(s.ctx, types.ContainerListOptions{})
+	containerList, err := s.docker.ContainerList(s.ctx, s.containerListOptions())
 	if err != nil {
 		log.Println("Error listing containers: ", err)
 		return err
@@ -106,53 +427,129 @@ func (s *server) loadRunningContainers() error {
 		}
 	}
 
+	// clean up records from a previous run
+	_, err = s.removeOrphans()
+	if err != nil {
+		log.Println("Error removing orphaned records: ", err)
+		return err
+	}
+
+	// no need to wait for the batch window
+	s.commit()
+
 	return nil
 }
 
-func (s *server) runEventLoop() error {
-	// we're only interested in container events
-	filter := filters.NewArgs()
-	filter.Add("type", events.ContainerEventType)
+func (s *server) runEventLoop(since time.Time) error {
+	// we're only interested in container events of the selected
+	// containers, and network events for containers being connected
+	// or disconnected, which are separate streams since label
+	// filters also apply to the labels of networks
+	containerFilter := s.selector.Clone()
+	containerFilter.Add("type", events.ContainerEventType)
+	networkFilter := filters.NewArgs()
+	networkFilter.Add("type", events.NetworkEventType)
+
+	// resume from the last seen event when reconnecting
+	delay := minReconnectDelay
+
+	for {
+		err := s.streamEvents(containerFilter, networkFilter, &since)
+		if s.ctx.Err() != nil {
+			log.Println("Event loop shutting down")
+			return nil
+		}
 
-	// open docker event stream
-	eventsChan, errorsChan := s.docker.Events(s.ctx, types.EventsOptions{Filters: filter})
+		// e.g. the docker daemon was restarted
+		log.Println("Event stream interrupted: ", err)
+		log.Printf("Reconnecting in %s...\n", delay)
 
-	// make channel for capturing returned value
-	// also provides elegant means for waiting on the event loop
-	result := make(chan error)
+		select {
+		case <-time.After(delay):
+		case <-s.ctx.Done():
+			log.Println("Event loop shutting down")
+			return nil
+		}
 
-	go func() {
-		for {
-			select {
-			case event := <-eventsChan:
-				if err := s.handleDockerEvent(event); err != nil {
-					log.Println("Event read failed: ", err)
-					result <- err
-					return
-				}
-			case err := <-errorsChan:
-				if err == io.EOF || err == context.Canceled {
-					log.Println("Event loop shutting down")
-					result <- nil
-				} else {
-					log.Println("Event loop shutting down: ", err)
-					result <- err
-				}
-				return
+		// catch up on changes missed whilst disconnected
+		log.Println("Reloading containers...")
+		err = s.reconcile(true)
+		if err != nil {
+			log.Println("Failed to reload containers: ", err)
+			delay *= 2
+			if delay > maxReconnectDelay {
+				delay = maxReconnectDelay
 			}
+			continue
 		}
-	}()
 
-	// wait here
-	return <-result
+		delay = minReconnectDelay
+	}
+}
+
+func (s *server) streamEvents(containerFilter filters.Args, networkFilter filters.Args, since *time.Time) error {
+	// closes both streams when either is interrupted
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	// open docker event streams
+	sinceValue := fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond())
+	containerEvents, containerErrors := s.docker.Events(ctx, types.EventsOptions{
+		Since:   sinceValue,
+		Filters: containerFilter,
+	})
+	networkEvents, networkErrors := s.docker.Events(ctx, types.EventsOptions{
+		Since:   sinceValue,
+		Filters: networkFilter,
+	})
+
+	for {
+		var event events.Message
+		var err error
+		select {
+		case event = <-containerEvents:
+		case event = <-networkEvents:
+		case err = <-containerErrors:
+		case err = <-networkErrors:
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				return errors.New("event stream closed")
+			}
+			return err
+		}
+
+		*since = time.Unix(0, event.TimeNano)
+		if err := s.handleDockerEvent(event); err != nil {
+			// reconciliation will catch up eventually
+			log.Println("Failed to handle event: ", err)
+		}
+	}
 }
 
 func (s *server) handleDockerEvent(event events.Message) error {
-	switch event.Action {
-	case "start":
-		return s.containerAdded(event.ID)
-	case "stop", "die":
-		return s.containerRemoved(event.ID)
+	switch event.Type {
+	case events.ContainerEventType:
+		switch event.Action {
+		case "start", "rename", "update":
+			return s.containerAdded(event.ID)
+		case "stop", "die":
+			return s.containerRemoved(event.ID)
+		}
+	case events.NetworkEventType:
+		switch event.Action {
+		case "create", "destroy":
+			if s.servesQueries() {
+				return s.refreshNetworks()
+			}
+		case "connect", "disconnect":
+			// the actor is the network, so the container is an attribute
+			containerID := event.Actor.Attributes["container"]
+			if len(containerID) > 0 {
+				return s.containerAdded(containerID)
+			}
+		}
 	}
 	return nil
 }
@@ -165,128 +562,173 @@ func (s *server) containerAdded(containerID string) error {
 
 	// get container metadata
 	meta, err := s.docker.ContainerInspect(s.ctx, containerID)
-	if err != nil {
+	if err != nil && client.IsErrNotFound(err) {
+		// already gone, e.g. disconnected whilst being removed
+		return s.unregister(containerID)
+	} else if err != nil {
 		log.Printf("[%s] Error inspecting container: %s\n", containerID, err)
 		return err
 	}
 
 	// obviously
+	// NB: containers are re-examined, so may no longer be running
 	if !meta.State.Running {
-		return nil
-	}
-
-	// look for special host label
-	subDomain := meta.Config.Labels[s.subDomainLabel]
-	if len(subDomain) == 0 {
-		return nil
+		return s.unregister(containerID)
 	}
 
-	// append domain
-	hostName := fmt.Sprintf("%s.%s", subDomain, s.domainSuffix)
-
-	// write "DNS" host file
-	file, err := os.Create(filepath.Join(s.hostsPath, containerID))
-	if err != nil {
-		log.Println("Error creating file: ", err)
-		return err
+	// e.g. connected to a network, but not served by this instance
+	if !s.selected(meta.Config.Labels) {
+		return s.unregister(containerID)
 	}
-	defer file.Close()
 
-	log.Printf("Registering %q\n", hostName)
-
-	for _, containerNetwork := range meta.NetworkSettings.Networks {
-		// IPv4 address
-		log.Printf(" → IPv4Address: %q\n", containerNetwork.IPAddress)
-		_, err = fmt.Fprintf(file, "%s\t%s\n", containerNetwork.IPAddress, hostName)
+	// evaluate the name template, i.e. the host label(s), of each domain
+	var hostNames []string
+	for _, d := range s.domains {
+		subDomains, err := s.containerNames(meta, d)
 		if err != nil {
-			log.Println("Error writing file (IPv4): ", err)
-			return err
+			log.Printf("[%s] Ignoring names for %s: %s\n", containerID, d, err)
+			continue
 		}
-
-		// IPv6 address
-		if len(containerNetwork.GlobalIPv6Address) > 0 {
-			log.Printf(" → IPv6Address: %q\n", containerNetwork.GlobalIPv6Address)
-			_, err = fmt.Fprintf(file, "%s\t%s\n", containerNetwork.GlobalIPv6Address, hostName)
+		for _, subDomain := range subDomains {
+			// append domain
+			hostName, err := NormalizeName(fmt.Sprintf("%s.%s", subDomain, d.suffix))
 			if err != nil {
-				log.Println("Error writing file (IPv6): ", err)
-				return err
+				log.Printf("[%s] Ignoring invalid sub-domain %q for %s: %s\n", containerID, subDomain, d, err)
+				continue
 			}
+			hostNames = appendUnique(hostNames, hostName)
 		}
 	}
 
-	return nil
-}
-
-func (s *server) containerRemoved(containerID string) error {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+	// e.g. renamed to a name which isn't registered
+	if len(hostNames) == 0 {
+		return s.unregister(containerID)
+	}
 
-	// TODO: queue up container removals so if multiple containers
-	// are terminating at the same time we don't unnecessarily
-	// signal dnsmasq to reload it's configuration
+	// stable names for addressing an individual replica
+	// of a scaled service, e.g. 1.api.ldh.dns
+	if s.replicaNames {
+		replica := replicaID(meta.Config.Labels, containerID)
+		var replicaHostNames []string
+		for _, hostName := range hostNames {
+			replicaHostName, err := NormalizeName(fmt.Sprintf("%s.%s", replica, hostName))
+			if err != nil {
+				log.Printf("[%s] Ignoring invalid replica name: %s\n", containerID, err)
+				continue
+			}
+			replicaHostNames = append(replicaHostNames, replicaHostName)
+		}
+		hostNames = append(hostNames, replicaHostNames...)
+	}
 
-	fileName := filepath.Join(s.hostsPath, containerID)
+	log.Printf("Registering %q\n", hostNames)
 
-	// file exists?
-	_, err := os.Stat(fileName)
+	// for resolving conflicts with other containers
+	started, err := time.Parse(time.RFC3339Nano, meta.State.StartedAt)
 	if err != nil {
-		// ignore error
-		return nil
+		log.Printf("[%s] Error parsing start time: %s\n", containerID, err)
 	}
 
-	// delete the file
-	err = os.Remove(fileName)
-	if err != nil {
-		// ignore error
-		return nil
+	entry := Entry{
+		ContainerID: containerID,
+		HostNames:   hostNames,
+		Services:    s.containerServices(meta.Config),
+		TTL:         s.defaultTTL,
 	}
 
-	// SIGHUP to reload config
-	return s.signalDnsmasq()
-}
+	// e.g. 0 for containers which churn rapidly, or longer for stable ones
+	if value := strings.TrimSpace(meta.Config.Labels[s.ttlLabel]); len(value) > 0 {
+		ttl, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			log.Printf("Ignoring %q label value: %s\n", s.ttlLabel, err)
+		} else {
+			entry.TTL = uint32(ttl)
+			log.Printf(" → TTL: %d\n", entry.TTL)
+		}
+	}
 
-func (s *server) signalDnsmasq() error {
-	pid, err := s.readDnsmasqPID()
-	if err != nil {
-		return err
+	for _, service := range entry.Services {
+		log.Printf(" → Service: %q port %d\n", service.Name, service.Port)
 	}
 
-	process, err := os.FindProcess(pid)
-	if err != nil {
-		log.Printf("Error finding dnsmasq process [PID: %d]: %s\n", pid, err)
-		return err
+	// e.g. for tenant sub-domains, *.app.ldh.dns
+	if value := meta.Config.Labels[s.wildcardLabel]; len(value) > 0 {
+		entry.Wildcard, err = strconv.ParseBool(value)
+		if err != nil {
+			log.Printf("Ignoring %q label value: %s\n", s.wildcardLabel, err)
+		} else if entry.Wildcard {
+			log.Println(" → Wildcard")
+		}
 	}
 
-	err = process.Signal(syscall.SIGHUP)
-	if err != nil {
-		log.Printf("Error signalling dnsmasq process [PID: %d]: %s\n", pid, err)
-		return err
+	// aliases of another name don't have addresses of their own
+	if value := strings.TrimSpace(meta.Config.Labels[s.cnameLabel]); len(value) > 0 {
+		for _, hostName := range hostNames {
+			target, err := NormalizeName(s.qualifyName(value, hostName))
+			if err != nil {
+				log.Printf("[%s] Ignoring invalid %q label value: %s\n", containerID, s.cnameLabel, err)
+				entry.Aliases = nil
+				break
+			}
+			log.Printf(" → CNAME: %q\n", target)
+			entry.Aliases = append(entry.Aliases, Alias{Name: hostName, Target: target})
+		}
+		if len(entry.Aliases) > 0 {
+			return s.register(entry, containerOwner(meta), started)
+		}
 	}
 
-	return nil
-}
+	// for finding which container owns an address without the docker CLI
+	if s.txtRecords {
+		entry.Text = containerText(meta)
+	}
 
-func (s *server) readDnsmasqPID() (int, error) {
-	contents, err := ioutil.ReadFile(s.pidFile)
-	if err != nil {
-		log.Printf("Error reading dnsmasq PID file %q: %s\n", s.pidFile, err)
-		return 0, err
+	for _, networkName := range s.selectNetworks(meta.Config.Labels, meta.NetworkSettings.Networks) {
+		containerNetwork := meta.NetworkSettings.Networks[networkName]
+
+		// IPv4 address
+		if ip := net.ParseIP(containerNetwork.IPAddress); ip != nil {
+			log.Printf(" → IPv4Address: %q\n", containerNetwork.IPAddress)
+			entry.Addresses = append(entry.Addresses, Address{IP: ip, Network: networkName})
+		}
+
+		// IPv6 address
+		if ip := net.ParseIP(containerNetwork.GlobalIPv6Address); ip != nil {
+			log.Printf(" → IPv6Address: %q\n", containerNetwork.GlobalIPv6Address)
+			entry.Addresses = append(entry.Addresses, Address{IP: ip, Network: networkName})
+		}
 	}
 
-	pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
-	if err != nil {
-		log.Printf("Invalid dnsmasq PID %q: %s\n", string(contents), err)
-		return 0, err
+	return s.register(entry, containerOwner(meta), started)
+}
+
+func (s *server) containerRemoved(containerID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.unregister(containerID)
+}
+
+func (s *server) unregister(containerID string) error {
+	// NOTE: must be called with the lock held
+
+	// only registered containers have records to remove
+	// NB: both "stop" and "die" events are received
+	if _, ok := s.claims[containerID]; !ok {
+		return nil
 	}
 
-	return pid, nil
+	delete(s.claims, containerID)
+
+	// names may pass to other containers
+	return s.resolveClaims()
 }
 
 // helper functions
 
 func contextWithSignal(ctx context.Context) context.Context {
 	newCtx, cancel := context.WithCancel(ctx)
-	signals := make(chan os.Signal)
+	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		select {
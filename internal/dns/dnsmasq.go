@@ -0,0 +1,384 @@
+package dns
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	dnsmasqConfigFileName = "ldhdns.conf"
+	// how long to wait for s6 to restart dnsmasq
+	dnsmasqRestartTimeout  = 5 * time.Second
+	dnsmasqRestartInterval = 100 * time.Millisecond
+)
+
+// dnsmasqSink writes a hosts file per container into the directory
+// given to dnsmasq via --hostsdir, and a generated configuration file
+// into the directory given via --conf-dir for other types of records
+type dnsmasqSink struct {
+	hostsPath  string
+	configFile string
+	pidFile    string
+	// default TTL, given by the "local-ttl" option
+	ttl uint32
+	// options which don't depend on the containers
+	options []string
+	// pending changes keyed by container ID, nil for removals
+	pending map[string]*Entry
+	// committed entries, for generating the configuration file
+	entries map[string]Entry
+	config  string
+	// whether dnsmasq was restarted with the configuration file, since
+	// the options are needed before any records are
+	configured bool
+	// PID of the dnsmasq process terminated for a restart, which
+	// may still be in the PID file until it has restarted
+	restartedPid int
+}
+
+func newDnsmasqSink(hostsPath string, configPath string, pidFile string, ttl uint32, options []string) *dnsmasqSink {
+	d := &dnsmasqSink{
+		hostsPath:  hostsPath,
+		configFile: filepath.Join(configPath, dnsmasqConfigFileName),
+		pidFile:    pidFile,
+		ttl:        ttl,
+		options:    options,
+		pending:    make(map[string]*Entry),
+		entries:    make(map[string]Entry),
+	}
+
+	// as left by a previous run, if any
+	if contents, err := ioutil.ReadFile(d.configFile); err == nil {
+		d.config = string(contents)
+	}
+
+	return d
+}
+
+func (d *dnsmasqSink) Add(entry Entry) error {
+	d.pending[entry.ContainerID] = &entry
+	return nil
+}
+
+func (d *dnsmasqSink) Remove(containerID string) error {
+	d.pending[containerID] = nil
+	return nil
+}
+
+func (d *dnsmasqSink) Commit() error {
+	if len(d.pending) == 0 && d.configured {
+		return nil
+	}
+
+	// apply all pending changes, so that multiple containers
+	// starting or terminating at the same time only
+	// signal dnsmasq to reload it's configuration once
+	var lastErr error
+	reload := false
+	for containerID, entry := range d.pending {
+		if entry == nil {
+			delete(d.entries, containerID)
+			removed, err := d.removeHostsFile(containerID)
+			if err != nil {
+				lastErr = err
+			}
+			reload = reload || removed
+		} else {
+			d.entries[containerID] = *entry
+			err := d.writeHostsFile(entry)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			reload = true
+		}
+	}
+	d.pending = make(map[string]*Entry)
+
+	config := d.generateConfig()
+	if config != d.config || !d.configured {
+		if config != d.config {
+			err := ioutil.WriteFile(d.configFile, []byte(config), 0644)
+			if err != nil {
+				log.Printf("Error writing file %q: %s\n", d.configFile, err)
+				return err
+			}
+			d.config = config
+		}
+
+		// dnsmasq only reads it's configuration files at startup, so it
+		// is terminated and restarted by the s6 supervisor instead,
+		// which also re-reads the hosts files
+		// NB: including initially, since dnsmasq may have started with the
+		// file left by a previous run; retried until it's delivered
+		log.Println("Restarting dnsmasq for configuration change")
+		err := d.signalDnsmasq(syscall.SIGTERM)
+		if err != nil {
+			return err
+		}
+	} else if reload {
+		// SIGHUP to reload config
+		err := d.signalDnsmasq(syscall.SIGHUP)
+		if err != nil {
+			return err
+		}
+	}
+	d.configured = true
+
+	return lastErr
+}
+
+func (d *dnsmasqSink) List() ([]string, error) {
+	files, err := ioutil.ReadDir(d.hostsPath)
+	if err != nil {
+		log.Printf("Error reading directory %q: %s\n", d.hostsPath, err)
+		return nil, err
+	}
+
+	present := make(map[string]bool)
+	for _, file := range files {
+		// skip hidden files, such as .keep
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		present[file.Name()] = true
+	}
+
+	// account for changes not yet committed
+	for containerID, entry := range d.pending {
+		present[containerID] = entry != nil
+	}
+
+	var containerIDs []string
+	for containerID, ok := range present {
+		if ok {
+			containerIDs = append(containerIDs, containerID)
+		}
+	}
+	return containerIDs, nil
+}
+
+func (d *dnsmasqSink) writeHostsFile(entry *Entry) error {
+	// write "DNS" host file
+	file, err := os.Create(filepath.Join(d.hostsPath, entry.ContainerID))
+	if err != nil {
+		log.Println("Error creating file: ", err)
+		return err
+	}
+	defer file.Close()
+
+	// hosts files can't express TTLs, so
+	// these are configured as host records
+	if entry.TTL != d.ttl {
+		return nil
+	}
+
+	// NB: dnsmasq answers reverse lookups (PTR) of each address from the
+	// hosts files too, and "bogus-priv" answers those of unknown private
+	// addresses with NXDOMAIN rather than forwarding them upstream
+	for _, address := range entry.Addresses {
+		_, err = fmt.Fprintf(file, "%s\t%s\n", address.IP, strings.Join(entry.HostNames, " "))
+		if err != nil {
+			log.Println("Error writing file: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *dnsmasqSink) removeHostsFile(containerID string) (bool, error) {
+	fileName := filepath.Join(d.hostsPath, containerID)
+
+	// file exists?
+	_, err := os.Stat(fileName)
+	if err != nil {
+		// ignore error
+		return false, nil
+	}
+
+	// delete the file
+	err = os.Remove(fileName)
+	if err != nil {
+		log.Printf("Error removing file %q: %s\n", fileName, err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// dnsmasqOptions returns the options making dnsmasq authoritative for the
+// domains, so queries for unknown names aren't leaked upstream, and which
+// restrict forwarding of other queries to the upstreams, if any
+func dnsmasqOptions(domains []domain, upstreams []string, ttl uint32, negativeTTL uint32) []string {
+	options := []string{
+		fmt.Sprintf("local-ttl=%d", ttl),
+		// NB: only for negative answers from the upstreams without an SOA
+		// record, since those for the domains have no SOA record at all
+		fmt.Sprintf("neg-ttl=%d", negativeTTL),
+	}
+	for _, d := range domains {
+		// local=[/[<domain>]/[domain/]][<ipaddr>]
+		options = append(options, fmt.Sprintf("local=/%s/", d.suffix))
+	}
+	if len(upstreams) > 0 {
+		options = append(options, "no-resolv")
+		for _, upstream := range upstreams {
+			options = append(options, fmt.Sprintf("server=%s", dnsmasqServer(upstream)))
+		}
+	}
+	return options
+}
+
+// generateConfig generates the dnsmasq directives for
+// records which can't be expressed in a hosts file
+func (d *dnsmasqSink) generateConfig() string {
+	containerIDs := make([]string, 0, len(d.entries))
+	for containerID := range d.entries {
+		containerIDs = append(containerIDs, containerID)
+	}
+	sort.Strings(containerIDs)
+
+	var directives strings.Builder
+	for _, option := range d.options {
+		_, _ = fmt.Fprintln(&directives, option)
+	}
+	for _, containerID := range containerIDs {
+		entry := d.entries[containerID]
+		if entry.TTL != d.ttl && len(entry.HostNames) > 0 {
+			for _, address := range entry.Addresses {
+				// host-record=<name>[,<name>....],[<IPv4-address>],[<IPv6-address>][,<TTL>]
+				_, _ = fmt.Fprintf(&directives, "host-record=%s,%s,%d\n", strings.Join(entry.HostNames, ","), address.IP, entry.TTL)
+			}
+		}
+		for _, alias := range entry.Aliases {
+			// cname=<cname>,[<cname>,]<target>[,<TTL>]
+			_, _ = fmt.Fprintf(&directives, "cname=%s,%s,%d\n", alias.Name, alias.Target, entry.TTL)
+			if entry.Wildcard {
+				_, _ = fmt.Fprintf(&directives, "cname=*.%s,%s,%d\n", alias.Name, alias.Target, entry.TTL)
+			}
+		}
+		if entry.Wildcard {
+			for _, hostName := range entry.HostNames {
+				for _, address := range entry.Addresses {
+					// address=/<domain>[/<domain>...]/[<ipaddr>], which includes sub-domains
+					_, _ = fmt.Fprintf(&directives, "address=/%s/%s\n", hostName, address.IP)
+				}
+			}
+		}
+		if len(entry.Text) > 0 {
+			quoted := make([]string, 0, len(entry.Text))
+			for _, text := range entry.Text {
+				// the start time changes each time a container is
+				// restarted, which would restart dnsmasq as well
+				if strings.HasPrefix(text, startedTextPrefix) {
+					continue
+				}
+				quoted = append(quoted, strconv.Quote(text))
+			}
+			for _, hostName := range entry.HostNames {
+				// txt-record=<name>[[,<text>],<text>]
+				_, _ = fmt.Fprintf(&directives, "txt-record=%s,%s\n", hostName, strings.Join(quoted, ","))
+			}
+		}
+		for _, hostName := range entry.HostNames {
+			for _, service := range entry.Services {
+				// srv-host=<_service>.<_prot>.[<domain>],[<target>[,<port>[,<priority>[,<weight>]]]]
+				_, _ = fmt.Fprintf(&directives, "srv-host=%s.%s,%s,%d\n", service.Name, hostName, hostName, service.Port)
+			}
+		}
+	}
+
+	// nothing to configure
+	if directives.Len() == 0 {
+		return ""
+	}
+
+	return "# generated by ldhdns - do not edit\n" + directives.String()
+}
+
+func (d *dnsmasqSink) signalDnsmasq(sig syscall.Signal) error {
+	pid, err := d.readRestartedDnsmasqPID()
+	if err != nil {
+		return err
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		log.Printf("Error finding dnsmasq process [PID: %d]: %s\n", pid, err)
+		return err
+	}
+
+	err = process.Signal(sig)
+	if err != nil {
+		log.Printf("Error signalling dnsmasq process [PID: %d]: %s\n", pid, err)
+		return err
+	}
+
+	if sig == syscall.SIGTERM {
+		d.restartedPid = pid
+	}
+
+	return nil
+}
+
+// readRestartedDnsmasqPID reads the PID of dnsmasq, waiting for it to
+// change when dnsmasq was terminated for a restart, so the signal isn't
+// sent to the terminated process, or for dnsmasq to start initially
+func (d *dnsmasqSink) readRestartedDnsmasqPID() (int, error) {
+	if d.restartedPid == 0 && d.configured {
+		return d.readDnsmasqPID()
+	}
+
+	deadline := time.Now().Add(dnsmasqRestartTimeout)
+	for {
+		pid, err := parseDnsmasqPID(d.pidFile)
+		if err == nil && pid != d.restartedPid {
+			d.restartedPid = 0
+			return pid, nil
+		}
+
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("dnsmasq [PID: %d] wasn't restarted within %s", pid, dnsmasqRestartTimeout)
+			}
+			log.Println("Error waiting for dnsmasq to start: ", err)
+			return 0, err
+		}
+		time.Sleep(dnsmasqRestartInterval)
+	}
+}
+
+// parseDnsmasqPID reads the PID file, without logging errors
+// since it's missing whilst dnsmasq is starting
+func parseDnsmasqPID(pidFile string) (int, error) {
+	contents, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(contents)))
+}
+
+func (d *dnsmasqSink) readDnsmasqPID() (int, error) {
+	contents, err := ioutil.ReadFile(d.pidFile)
+	if err != nil {
+		log.Printf("Error reading dnsmasq PID file %q: %s\n", d.pidFile, err)
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	if err != nil {
+		log.Printf("Invalid dnsmasq PID %q: %s\n", string(contents), err)
+		return 0, err
+	}
+
+	return pid, nil
+}
@@ -0,0 +1,47 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+)
+
+// domain is a domain suffix being served, along with the
+// label containers use to provide their sub-domain for it
+type domain struct {
+	suffix         string
+	subDomainLabel string
+}
+
+// parseDomains parses "<suffix>[=<label>]" values, using the default
+// label for suffixes which aren't mapped to their own label
+func parseDomains(values []string, defaultLabel string) ([]domain, error) {
+	var domains []domain
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		suffix, err := NormalizeName(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid domain suffix %q: %s", value, err)
+		}
+		d := domain{
+			suffix:         suffix,
+			subDomainLabel: defaultLabel,
+		}
+		if len(parts) == 2 {
+			d.subDomainLabel = strings.TrimSpace(parts[1])
+		}
+		if len(d.subDomainLabel) == 0 {
+			return nil, fmt.Errorf("invalid domain suffix %q", value)
+		}
+		domains = append(domains, d)
+	}
+
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("no domain suffix provided")
+	}
+
+	return domains, nil
+}
+
+func (d domain) String() string {
+	return fmt.Sprintf("%q domain with %q container label", d.suffix, d.subDomainLabel)
+}
@@ -0,0 +1,118 @@
+package dns
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+)
+
+const (
+	hostGatewayEntryID = "host-gateway"
+)
+
+// parseHostGateways parses "<network>=<ip>" values, as given by
+// the controller, of the gateways of the docker bridge networks
+func parseHostGateways(values []string) ([]Address, error) {
+	var gateways []Address
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if len(value) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid host gateway %q; expected <network>=<ip>", value)
+		}
+
+		ip := net.ParseIP(strings.TrimSpace(parts[1]))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid host gateway %q; expected an IP address", value)
+		}
+
+		gateways = append(gateways, Address{IP: ip, Network: strings.TrimSpace(parts[0])})
+	}
+	return gateways, nil
+}
+
+// updateHostGateway publishes the host name, e.g. host.ldh.dns, for
+// the gateways, so containers can reach services running on the host
+func (s *server) updateHostGateway() error {
+	if len(s.hostName) == 0 {
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var hostNames []string
+	for _, d := range s.domains {
+		hostNames = append(hostNames, fmt.Sprintf("%s.%s", s.hostName, d.suffix))
+	}
+
+	entry := Entry{
+		ContainerID: hostGatewayEntryID,
+		HostNames:   hostNames,
+		Addresses:   s.hostGatewayAddresses(),
+		TTL:         s.defaultTTL,
+	}
+
+	// replaced, in case the gateways changed
+	if _, ok := s.staticApplied[entry.ContainerID]; ok {
+		err := s.sink.Remove(entry.ContainerID)
+		if err != nil {
+			return err
+		}
+		delete(s.staticApplied, entry.ContainerID)
+		s.changed()
+	}
+
+	s.gatewayRecords = nil
+	if len(entry.Addresses) > 0 {
+		s.gatewayRecords = []Entry{entry}
+	}
+
+	return s.applyStaticRecords()
+}
+
+// hostGatewayAddresses returns the gateway of each network when the
+// querying container's network is known (split horizon), otherwise
+// only the gateway of the managed bridge network
+func (s *server) hostGatewayAddresses() []Address {
+	gateways := make(map[string]Address)
+	for _, gateway := range s.hostGateways {
+		gateways[gateway.Network] = gateway
+	}
+
+	if !s.splitHorizon {
+		if gateway, ok := gateways[s.networkId]; ok {
+			return []Address{gateway}
+		}
+	} else {
+		// including networks created since the controller started
+		for _, gateway := range s.networks.gateways() {
+			if _, ok := gateways[gateway.Network]; !ok {
+				gateways[gateway.Network] = gateway
+			}
+		}
+	}
+
+	// ordered, so the records are stable
+	networkNames := make([]string, 0, len(gateways))
+	for networkName := range gateways {
+		networkNames = append(networkNames, networkName)
+	}
+	sort.Strings(networkNames)
+
+	addresses := make([]Address, 0, len(networkNames))
+	for _, networkName := range networkNames {
+		addresses = append(addresses, gateways[networkName])
+	}
+
+	if len(addresses) == 0 {
+		log.Printf("No gateways known for the %q host name\n", s.hostName)
+	}
+	return addresses
+}
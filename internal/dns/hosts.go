@@ -0,0 +1,118 @@
+package dns
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// hostsFileSink writes the records of all containers into a single
+// /etc/hosts style file, e.g. for the CoreDNS hosts plugin
+type hostsFileSink struct {
+	fileName string
+	entries  map[string]Entry
+	dirty    bool
+}
+
+func newHostsFileSink(fileName string) *hostsFileSink {
+	return &hostsFileSink{
+		fileName: fileName,
+		entries:  make(map[string]Entry),
+		// replaces the file left by a previous run on the first commit
+		dirty: true,
+	}
+}
+
+func (h *hostsFileSink) Add(entry Entry) error {
+	h.entries[entry.ContainerID] = entry
+	h.dirty = true
+	return nil
+}
+
+func (h *hostsFileSink) Remove(containerID string) error {
+	if _, ok := h.entries[containerID]; !ok {
+		return nil
+	}
+
+	delete(h.entries, containerID)
+	h.dirty = true
+	return nil
+}
+
+func (h *hostsFileSink) Commit() error {
+	if !h.dirty {
+		return nil
+	}
+
+	err := h.write()
+	if err != nil {
+		return err
+	}
+
+	h.dirty = false
+	return nil
+}
+
+func (h *hostsFileSink) List() ([]string, error) {
+	// NB: the file is rewritten in full, including on startup,
+	// so nothing is left over
+	containerIDs := make([]string, 0, len(h.entries))
+	for containerID := range h.entries {
+		containerIDs = append(containerIDs, containerID)
+	}
+	return containerIDs, nil
+}
+
+func (h *hostsFileSink) write() error {
+	// write to a temporary file and rename it over the original
+	// so that readers never observe a partially written file
+	// NOTE: the directory, not the file, should be bind mounted
+	file, err := ioutil.TempFile(filepath.Dir(h.fileName), ".hosts")
+	if err != nil {
+		log.Println("Error creating file: ", err)
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	// sorted, so the file is stable between writes
+	containerIDs := make([]string, 0, len(h.entries))
+	for containerID := range h.entries {
+		containerIDs = append(containerIDs, containerID)
+	}
+	sort.Strings(containerIDs)
+
+	writer := bufio.NewWriter(file)
+	_, _ = fmt.Fprintln(writer, "# generated by ldhdns - do not edit")
+	for _, containerID := range containerIDs {
+		entry := h.entries[containerID]
+		for _, address := range entry.Addresses {
+			_, _ = fmt.Fprintf(writer, "%s\t%s\n", address.IP, strings.Join(entry.HostNames, " "))
+		}
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		log.Println("Error writing file: ", err)
+		return err
+	}
+
+	err = file.Chmod(0644)
+	if err != nil {
+		log.Println("Error writing file: ", err)
+		return err
+	}
+
+	err = os.Rename(file.Name(), h.fileName)
+	if err != nil {
+		log.Printf("Error replacing file %q: %s\n", h.fileName, err)
+		return err
+	}
+
+	return nil
+}
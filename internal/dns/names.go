@@ -0,0 +1,144 @@
+package dns
+
+import (
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	composeProjectLabel         = "com.docker.compose.project"
+	composeServiceLabel         = "com.docker.compose.service"
+	composeContainerNumberLabel = "com.docker.compose.container-number"
+	startedTextPrefix           = "started="
+)
+
+// containerSubDomains returns the sub-domains of the container for the
+// domain, with the explicit label taking precedence over compose names
+func (s *server) containerSubDomains(labels map[string]string, d domain) []string {
+	names := subDomains(labels, d.subDomainLabel)
+	if len(names) > 0 {
+		return names
+	}
+
+	if s.composeNames {
+		return s.composeSubDomains(labels)
+	}
+
+	return nil
+}
+
+// composeSubDomains derives "<service>.<project>" and optionally
+// "<service>-<n>.<project>" from the labels docker compose applies
+func (s *server) composeSubDomains(labels map[string]string) []string {
+	// e.g. "web_app" becomes "web-app", since compose allows underscores
+	project := sanitizeLabel(labels[composeProjectLabel])
+	service := sanitizeLabel(labels[composeServiceLabel])
+	if len(project) == 0 || len(service) == 0 {
+		return nil
+	}
+
+	names := []string{fmt.Sprintf("%s.%s", service, project)}
+
+	number := labels[composeContainerNumberLabel]
+	if s.composeNumberedNames && len(number) > 0 {
+		names = append(names, fmt.Sprintf("%s-%s.%s", service, number, project))
+	}
+
+	return names
+}
+
+// replicaID identifies a single replica of a service, using the
+// compose container number when available or the short container ID
+func replicaID(labels map[string]string, containerID string) string {
+	if number := labels[composeContainerNumberLabel]; len(number) > 0 {
+		return number
+	}
+	return shortID(containerID)
+}
+
+// subDomains returns the sub-domains provided by the label, which may
+// be a comma separated list, followed by those of any indexed labels
+// such as "<label>.1", "<label>.2" in index order
+func subDomains(labels map[string]string, label string) []string {
+	values := []string{labels[label]}
+
+	// indexed labels
+	type indexed struct {
+		index int
+		value string
+	}
+	var indexedValues []indexed
+	prefix := label + "."
+	for key, value := range labels {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimPrefix(key, prefix))
+		if err != nil {
+			continue
+		}
+		indexedValues = append(indexedValues, indexed{index: index, value: value})
+	}
+	sort.Slice(indexedValues, func(i, j int) bool {
+		return indexedValues[i].index < indexedValues[j].index
+	})
+	for _, item := range indexedValues {
+		values = append(values, item.value)
+	}
+
+	var names []string
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if len(name) > 0 {
+				names = appendUnique(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// containerText returns the metadata of the container published as
+// TXT record strings, i.e. "<key>=<value>" pairs
+func containerText(meta types.ContainerJSON) []string {
+	text := []string{
+		fmt.Sprintf("id=%s", meta.ID),
+		fmt.Sprintf("image=%s", meta.Config.Image),
+	}
+	if project := meta.Config.Labels[composeProjectLabel]; len(project) > 0 {
+		text = append(text, fmt.Sprintf("compose-project=%s", project))
+	}
+	if service := meta.Config.Labels[composeServiceLabel]; len(service) > 0 {
+		text = append(text, fmt.Sprintf("compose-service=%s", service))
+	}
+	if meta.State != nil && len(meta.State.StartedAt) > 0 {
+		text = append(text, startedTextPrefix+meta.State.StartedAt)
+	}
+	return text
+}
+
+// qualifyName qualifies a name relative to the domain of the host name,
+// unless it's already fully qualified, i.e. ends with a dot
+func (s *server) qualifyName(name string, hostName string) string {
+	if strings.HasSuffix(name, ".") {
+		return canonicalName(name)
+	}
+	for _, d := range s.domains {
+		if hostName == d.suffix || strings.HasSuffix(hostName, "."+d.suffix) {
+			return fmt.Sprintf("%s.%s", name, d.suffix)
+		}
+	}
+	return name
+}
+
+func appendUnique(items []string, item string) []string {
+	for _, existing := range items {
+		if existing == item {
+			return items
+		}
+	}
+	return append(items, item)
+}
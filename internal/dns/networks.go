@@ -0,0 +1,169 @@
+package dns
+
+import (
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// networkTable maps the subnets of docker networks to their names,
+// so the network of a client querying the DNS server can be determined
+type networkTable struct {
+	lock    sync.RWMutex
+	subnets []networkSubnet
+}
+
+type networkSubnet struct {
+	network string
+	subnet  *net.IPNet
+	gateway net.IP
+}
+
+// selectNetworks returns the names of the networks whose addresses are
+// published for the container, in the order they should be published
+func (s *server) selectNetworks(labels map[string]string, networks map[string]*network.EndpointSettings) []string {
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// restricted by the container's own label
+	if value := labels[s.networkLabel]; len(value) > 0 {
+		var selected []string
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := networks[name]; ok {
+				selected = appendUnique(selected, name)
+			}
+		}
+		if len(selected) > 0 {
+			return selected
+		}
+		log.Printf("Container isn't attached to the %q network(s) given by the %q label; using all networks\n", value, s.networkLabel)
+	}
+
+	// restricted to the first preferred network attached to
+	for _, name := range s.preferNetworks {
+		if _, ok := networks[name]; ok {
+			return []string{name}
+		}
+	}
+
+	// the managed bridge network first, since it's
+	// always reachable from the host
+	if s.bridgeFirst {
+		for i, name := range names {
+			if name == s.networkId {
+				copy(names[1:i+1], names[:i])
+				names[0] = name
+				break
+			}
+		}
+	}
+
+	return names
+}
+
+func (s *server) refreshNetworks() error {
+	networks, err := s.docker.NetworkList(s.ctx, types.NetworkListOptions{})
+	if err != nil {
+		log.Println("Error listing networks: ", err)
+		return err
+	}
+
+	var subnets []networkSubnet
+	for _, nw := range networks {
+		for _, config := range nw.IPAM.Config {
+			_, subnet, err := net.ParseCIDR(config.Subnet)
+			if err != nil {
+				continue
+			}
+			subnets = append(subnets, networkSubnet{
+				network: nw.Name,
+				subnet:  subnet,
+				gateway: net.ParseIP(config.Gateway),
+			})
+		}
+	}
+
+	s.networks.lock.Lock()
+	s.networks.subnets = subnets
+	s.networks.lock.Unlock()
+
+	// the gateways of new networks
+	return s.updateHostGateway()
+}
+
+// gateways returns the gateway addresses of the networks
+func (t *networkTable) gateways() []Address {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	var addresses []Address
+	for _, item := range t.subnets {
+		if item.gateway != nil {
+			addresses = append(addresses, Address{IP: item.gateway, Network: item.network})
+		}
+	}
+	return addresses
+}
+
+// networksOf returns the names of the networks the address is on
+func (t *networkTable) networksOf(ip net.IP) []string {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	var names []string
+	for _, item := range t.subnets {
+		// the gateway is the host itself
+		if item.gateway != nil && item.gateway.Equal(ip) {
+			return nil
+		}
+		if item.subnet.Contains(ip) {
+			names = append(names, item.network)
+		}
+	}
+	return names
+}
+
+// contains determines whether the address is within
+// the subnet of one of the networks
+func (t *networkTable) contains(ip net.IP) bool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	for _, item := range t.subnets {
+		if item.subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameNetwork returns the addresses on the same network(s) as the
+// client, or all of them when there are none, e.g. for the host
+func sameNetwork(addresses []Address, clientNetworks []string) []Address {
+	if len(clientNetworks) == 0 {
+		return addresses
+	}
+
+	var selected []Address
+	for _, address := range addresses {
+		for _, name := range clientNetworks {
+			if address.Network == name {
+				selected = append(selected, address)
+				break
+			}
+		}
+	}
+
+	if len(selected) == 0 {
+		return addresses
+	}
+	return selected
+}
@@ -0,0 +1,172 @@
+package dns
+
+import (
+	"github.com/docker/docker/api/types"
+	"log"
+	"strings"
+	"time"
+)
+
+// runReconcileLoop periodically reconciles the registered containers
+// against the Docker API, in case any events were missed
+func (s *server) runReconcileLoop() {
+	if s.reconcileInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.reconcileInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.reconcile(false); err != nil {
+					log.Println("Failed to reconcile containers: ", err)
+				}
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// reconcile adds missing and removes orphaned records, and when
+// full is true re-examines all containers, not only unregistered ones
+func (s *server) reconcile(full bool) error {
+	if s.servesQueries() {
+		if err := s.refreshNetworks(); err != nil {
+			return err
+		}
+	}
+
+	containerList, err := s.docker.ContainerList(s.ctx, s.containerListOptions())
+	if err != nil {
+		log.Println("Error listing containers: ", err)
+		return err
+	}
+
+	running := make(map[string]bool, len(containerList))
+	var candidates []string
+	for _, container := range containerList {
+		running[container.ID] = true
+		if !s.isCandidate(container) {
+			continue
+		}
+		if full || !s.isRegistered(container.ID) {
+			candidates = append(candidates, container.ID)
+		}
+	}
+
+	// registered containers which aren't running are re-examined
+	// rather than removed outright, since they may have been
+	// started after the list was obtained
+	var stale []string
+	s.lock.RLock()
+	for containerID := range s.claims {
+		if !running[containerID] {
+			stale = append(stale, containerID)
+		}
+	}
+	s.lock.RUnlock()
+
+	missing := 0
+	for _, containerID := range candidates {
+		wasRegistered := s.isRegistered(containerID)
+		if err := s.containerAdded(containerID); err != nil {
+			return err
+		}
+		if !wasRegistered && s.isRegistered(containerID) {
+			log.Printf("[%s] Drift detected: container records were missing\n", containerID)
+			missing++
+		}
+	}
+
+	orphaned := 0
+	for _, containerID := range stale {
+		if err := s.containerAdded(containerID); err != nil {
+			return err
+		}
+		if !s.isRegistered(containerID) {
+			log.Printf("[%s] Drift detected: container records were orphaned\n", containerID)
+			orphaned++
+		}
+	}
+
+	removed, err := s.removeOrphans()
+	if err != nil {
+		return err
+	}
+	orphaned += removed
+
+	if missing > 0 || orphaned > 0 {
+		log.Printf("Reconciled drift: %d missing, %d orphaned\n", missing, orphaned)
+	}
+
+	return nil
+}
+
+// removeOrphans removes records held by the backend for containers
+// which aren't registered, such as those left over from a previous run,
+// keeping the static records
+func (s *server) removeOrphans() (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	containerIDs, err := s.sink.List()
+	if err != nil {
+		log.Println("Error listing records: ", err)
+		return 0, err
+	}
+
+	removed := 0
+	for _, containerID := range containerIDs {
+		if _, ok := s.registered[containerID]; ok {
+			continue
+		}
+		if _, ok := s.staticApplied[containerID]; ok {
+			continue
+		}
+
+		log.Printf("[%s] Removing orphaned records\n", containerID)
+		err = s.sink.Remove(containerID)
+		if err != nil {
+			return removed, err
+		}
+
+		s.changed()
+		removed++
+	}
+
+	return removed, nil
+}
+
+func (s *server) isRegistered(containerID string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	_, ok := s.claims[containerID]
+	return ok
+}
+
+// isCandidate determines from its labels and name whether
+// a container would be registered, avoiding an inspection
+func (s *server) isCandidate(container types.Container) bool {
+	// names from a template may not depend on labels
+	if s.templatedNames {
+		return true
+	}
+	labels := container.Labels
+	for _, name := range container.Names {
+		// other names are those of links, i.e. "/<other>/<alias>"
+		if strings.Count(name, "/") == 1 && len(s.registerAllName(name, labels)) > 0 {
+			return true
+		}
+	}
+	for _, d := range s.domains {
+		if len(s.containerSubDomains(labels, d)) > 0 {
+			return true
+		}
+	}
+	return false
+}
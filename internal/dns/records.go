@@ -0,0 +1,194 @@
+package dns
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// recordTable holds the entries registered for each container
+// and an index of host name to entries for answering queries
+type recordTable struct {
+	lock       sync.RWMutex
+	containers map[string]Entry
+	names      map[string][]Entry
+	wildcards  map[string][]Entry
+	services   map[string][]serviceTarget
+	addresses  map[string][]Entry
+	// parents of the names, which exist without records of their own,
+	// i.e. empty non-terminals such as shop.ldh.dns for web.shop.ldh.dns
+	parents map[string]struct{}
+}
+
+// serviceTarget is the target of an SRV record
+type serviceTarget struct {
+	hostName string
+	port     uint16
+	ttl      uint32
+}
+
+func newRecordTable() *recordTable {
+	return &recordTable{
+		containers: make(map[string]Entry),
+		names:      make(map[string][]Entry),
+		wildcards:  make(map[string][]Entry),
+		services:   make(map[string][]serviceTarget),
+		addresses:  make(map[string][]Entry),
+		parents:    make(map[string]struct{}),
+	}
+}
+
+func (t *recordTable) Add(entry Entry) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.containers[entry.ContainerID] = entry
+	t.reindex()
+	return nil
+}
+
+func (t *recordTable) Remove(containerID string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.containers[containerID]; !ok {
+		return nil
+	}
+
+	delete(t.containers, containerID)
+	t.reindex()
+	return nil
+}
+
+// Commit is a no-op since changes are applied immediately
+func (t *recordTable) Commit() error {
+	return nil
+}
+
+func (t *recordTable) List() ([]string, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	containerIDs := make([]string, 0, len(t.containers))
+	for containerID := range t.containers {
+		containerIDs = append(containerIDs, containerID)
+	}
+	return containerIDs, nil
+}
+
+// lookup returns the entries of the containers registered with the
+// given host name, the registered name it matched, which differs for
+// wildcards, and whether the name is known at all
+func (t *recordTable) lookup(hostName string) ([]Entry, string, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	name := canonicalName(hostName)
+	if entries, ok := t.names[name]; ok {
+		return entries, name, true
+	}
+
+	// names of services exist, but without addresses
+	if _, ok := t.services[name]; ok {
+		return nil, name, true
+	}
+
+	// names below it exist, so wildcards don't apply to it either
+	if _, ok := t.parents[name]; ok {
+		return nil, name, true
+	}
+
+	// the closest wildcard parent, e.g. app.ldh.dns for tenant.app.ldh.dns
+	labels := strings.Split(name, ".")
+	for i := 1; i < len(labels); i++ {
+		parent := strings.Join(labels[i:], ".")
+		if entries, ok := t.wildcards[parent]; ok {
+			return entries, parent, true
+		}
+	}
+
+	return nil, name, false
+}
+
+// lookupAddress returns the entries of the containers with the address,
+// the first name of each being used for reverse lookups
+func (t *recordTable) lookupAddress(ip net.IP) []Entry {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.addresses[ip.String()]
+}
+
+// lookupServices returns the targets of the SRV records for the name
+func (t *recordTable) lookupServices(name string) []serviceTarget {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.services[canonicalName(name)]
+}
+
+func (t *recordTable) reindex() {
+	// NOTE: must be called with the lock held
+
+	// ordered by container ID, so answers are stable
+	containerIDs := make([]string, 0, len(t.containers))
+	for containerID := range t.containers {
+		containerIDs = append(containerIDs, containerID)
+	}
+	sort.Strings(containerIDs)
+
+	names := make(map[string][]Entry)
+	wildcards := make(map[string][]Entry)
+	services := make(map[string][]serviceTarget)
+	addresses := make(map[string][]Entry)
+	for _, containerID := range containerIDs {
+		entry := t.containers[containerID]
+		if len(entry.HostNames) > 0 {
+			for _, address := range entry.Addresses {
+				key := address.IP.String()
+				addresses[key] = append(addresses[key], entry)
+			}
+		}
+
+		for _, hostName := range entry.HostNames {
+			name := canonicalName(hostName)
+			names[name] = append(names[name], entry)
+			if entry.Wildcard {
+				wildcards[name] = append(wildcards[name], entry)
+			}
+
+			for _, service := range entry.Services {
+				serviceName := canonicalName(service.Name + "." + hostName)
+				services[serviceName] = append(services[serviceName], serviceTarget{hostName: name, port: service.Port, ttl: entry.TTL})
+			}
+		}
+	}
+	parents := make(map[string]struct{})
+	for name := range names {
+		addParents(parents, name)
+	}
+	for name := range services {
+		addParents(parents, name)
+	}
+
+	t.names = names
+	t.wildcards = wildcards
+	t.services = services
+	t.addresses = addresses
+	t.parents = parents
+}
+
+// addParents adds the names of the parent domains of the name
+func addParents(parents map[string]struct{}, name string) {
+	labels := strings.Split(name, ".")
+	for i := 1; i < len(labels); i++ {
+		parents[strings.Join(labels[i:], ".")] = struct{}{}
+	}
+}
+
+// canonicalName lowercases the name and strips the trailing dot
+// so names from queries and labels can be compared
+func canonicalName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
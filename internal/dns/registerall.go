@@ -0,0 +1,71 @@
+package dns
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// registerAllName returns the sanitised container name, used as the
+// sub-domain of containers without names when registering all
+// containers, unless excluded by its label or the name patterns
+func (s *server) registerAllName(name string, labels map[string]string) string {
+	if !s.registerAll {
+		return ""
+	}
+
+	name = strings.TrimPrefix(name, "/")
+	if len(name) == 0 {
+		return ""
+	}
+
+	if value := labels[s.registerExcludeLabel]; len(value) > 0 {
+		excluded, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Printf("Ignoring %q label value: %s\n", s.registerExcludeLabel, err)
+		} else if excluded {
+			return ""
+		}
+	}
+
+	if s.registerInclude != nil && !s.registerInclude.MatchString(name) {
+		return ""
+	}
+	if s.registerExclude != nil && s.registerExclude.MatchString(name) {
+		return ""
+	}
+
+	return sanitizeLabel(name)
+}
+
+// sanitizeLabel converts a container name, which may contain
+// underscores, dots and uppercase letters, into a DNS label
+func sanitizeLabel(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, c := range strings.ToLower(name) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			b.WriteRune(c)
+			hyphen = false
+		} else if !hyphen {
+			// e.g. "my_app.1" becomes "my-app-1"
+			b.WriteRune('-')
+			hyphen = true
+		}
+	}
+
+	label := strings.Trim(b.String(), "-")
+	if len(label) > maxLabelLength {
+		label = strings.TrimRight(label[:maxLabelLength], "-")
+	}
+	return label
+}
+
+// parseNamePattern compiles the regular expression, unless empty
+func parseNamePattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) == 0 {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
@@ -0,0 +1,38 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeLabel(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "postgres", expected: "postgres"},
+		{name: "My_Postgres.1", expected: "my-postgres-1"},
+		{name: "web_app", expected: "web-app"},
+		{name: "a__b..c", expected: "a-b-c"},
+		{name: "_leading", expected: "leading"},
+		{name: "trailing_", expected: "trailing"},
+		{name: "___", expected: ""},
+		{name: "café", expected: "caf"},
+		{name: strings.Repeat("a", 70), expected: strings.Repeat("a", 63)},
+		{name: strings.Repeat("a", 62) + "_b", expected: strings.Repeat("a", 62)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := sanitizeLabel(test.name)
+			if actual != test.expected {
+				t.Errorf("got %q, expected %q", actual, test.expected)
+			}
+			if len(actual) > 0 {
+				if err := validateLabel(actual); err != nil {
+					t.Errorf("invalid label: %s", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package dns
+
+import (
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"strings"
+)
+
+// parseSelector parses "<key>[=<value>]" docker label filters, all of
+// which the containers served must match
+func parseSelector(values []string) (filters.Args, error) {
+	selector := filters.NewArgs()
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if len(value) == 0 {
+			continue
+		}
+		if strings.HasPrefix(value, "=") {
+			return selector, fmt.Errorf("invalid selector %q: missing label key", value)
+		}
+		selector.Add("label", value)
+	}
+	return selector, nil
+}
+
+// containerListOptions lists the running containers matching the
+// selector, filtered by the docker API rather than after inspection
+func (s *server) containerListOptions() types.ContainerListOptions {
+	return types.ContainerListOptions{
+		Filters: s.selector.Clone(),
+	}
+}
+
+// selected determines whether the labels of a container match the
+// selector, for containers found other than by listing them, e.g.
+// from network events
+func (s *server) selected(labels map[string]string) bool {
+	return s.selector.MatchKVList("label", labels)
+}
@@ -0,0 +1,448 @@
+package dns
+
+import (
+	miekg "github.com/miekg/dns"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// aliases of aliases followed, guarding against loops
+	maxAliasChain = 8
+)
+
+func (s *server) listenAndServe(address string) error {
+	handler := miekg.HandlerFunc(s.handleQuery)
+
+	s.listeners = []*miekg.Server{
+		{Addr: address, Net: "udp", Handler: handler},
+		{Addr: address, Net: "tcp", Handler: handler},
+	}
+
+	for _, listener := range s.listeners {
+		started := make(chan struct{})
+		failed := make(chan error, 1)
+		listener.NotifyStartedFunc = func() { close(started) }
+
+		go func(listener *miekg.Server) {
+			err := listener.ListenAndServe()
+			if err != nil {
+				log.Printf("DNS listener (%s) stopped: %s\n", listener.Net, err)
+			}
+			failed <- err
+		}(listener)
+
+		// wait until listening, so bind errors are reported
+		select {
+		case <-started:
+		case err := <-failed:
+			s.shutdownListeners()
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *server) shutdownListeners() {
+	for _, listener := range s.listeners {
+		if err := listener.Shutdown(); err != nil {
+			log.Printf("Failed to shutdown DNS listener (%s): %s\n", listener.Net, err)
+		}
+	}
+	s.listeners = nil
+}
+
+func (s *server) handleQuery(w miekg.ResponseWriter, req *miekg.Msg) {
+	msg := new(miekg.Msg)
+	msg.SetReply(req)
+	msg.Authoritative = true
+
+	// answer with the addresses on the same network as the client
+	var clientNetworks []string
+	if s.splitHorizon {
+		clientNetworks = s.networks.networksOf(remoteIP(w.RemoteAddr()))
+	}
+
+	for _, question := range req.Question {
+		// reverse lookups of container addresses, routed
+		// for the subnets of the docker bridge networks
+		if ip := reverseIP(question.Name); ip != nil {
+			entries := s.records.lookupAddress(ip)
+			if len(entries) == 0 {
+				// other addresses aren't ours to deny
+				if !s.networks.contains(ip) {
+					if len(s.upstreams) > 0 {
+						s.forwardQuery(w, req)
+						return
+					}
+					msg.Authoritative = false
+					msg.Rcode = miekg.RcodeRefused
+					break
+				}
+				msg.Rcode = miekg.RcodeNameError
+				continue
+			}
+			if question.Qtype == miekg.TypePTR || question.Qtype == miekg.TypeANY {
+				for _, entry := range entries {
+					msg.Answer = append(msg.Answer, pointerRecord(question, entry.HostNames[0], entry.TTL))
+				}
+			}
+			continue
+		}
+
+		// only answer for our own domains
+		if !s.isServedName(question.Name) {
+			if len(s.upstreams) > 0 {
+				s.forwardQuery(w, req)
+				return
+			}
+			msg.Authoritative = false
+			msg.Rcode = miekg.RcodeRefused
+			break
+		}
+
+		entries, owner, ok := s.records.lookup(question.Name)
+
+		// the apex of the domains always exists, with it's SOA record
+		if s.isApex(question.Name) {
+			ok = true
+			if question.Qtype == miekg.TypeSOA || question.Qtype == miekg.TypeANY {
+				msg.Answer = append(msg.Answer, s.authorityRecord(question.Name))
+			}
+		}
+
+		if !ok {
+			msg.Rcode = miekg.RcodeNameError
+			msg.Ns = append(msg.Ns, s.authorityRecord(question.Name))
+			continue
+		}
+
+		// an alias has no other records of it's own
+		if alias, ok := aliasOf(entries, owner); ok {
+			msg.Answer = append(msg.Answer, s.aliasRecords(question, alias, clientNetworks)...)
+			continue
+		}
+
+		msg.Answer = append(msg.Answer, s.addressRecords(question, entries, clientNetworks)...)
+
+		if question.Qtype == miekg.TypeTXT || question.Qtype == miekg.TypeANY {
+			for _, entry := range entries {
+				if len(entry.Text) > 0 {
+					msg.Answer = append(msg.Answer, textRecord(question, entry.Text, entry.TTL))
+				}
+			}
+		}
+
+		if question.Qtype == miekg.TypeSRV || question.Qtype == miekg.TypeANY {
+			for _, target := range s.records.lookupServices(question.Name) {
+				msg.Answer = append(msg.Answer, serviceRecord(question, target))
+
+				// include the addresses of the target, saving a round trip
+				msg.Extra = append(msg.Extra, s.targetAddressRecords(target.hostName, clientNetworks)...)
+			}
+		}
+
+		// no records of the type asked for, i.e. NODATA
+		if len(msg.Answer) == 0 {
+			msg.Ns = append(msg.Ns, s.authorityRecord(question.Name))
+		}
+	}
+
+	// fitted to the client's buffer, setting TC so it retries over TCP
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		size := miekg.MinMsgSize
+		if opt := req.IsEdns0(); opt != nil {
+			size = int(opt.UDPSize())
+		}
+		msg.Truncate(size)
+	}
+
+	if err := w.WriteMsg(msg); err != nil {
+		log.Println("Failed to write DNS response: ", err)
+	}
+}
+
+// addressRecords makes the A and AAAA records of the entries
+func (s *server) addressRecords(question miekg.Question, entries []Entry, clientNetworks []string) []miekg.RR {
+	var records []miekg.RR
+
+	// rotate the containers of names registered by more than
+	// one container, e.g. scaled services, for round-robin
+	// NB: the order of each container's addresses is kept
+	for _, entry := range s.rotate(entries) {
+		for _, address := range sameNetwork(entry.Addresses, clientNetworks) {
+			if rr := addressRecord(question, address.IP, entry.TTL); rr != nil {
+				records = append(records, rr)
+			}
+		}
+	}
+	return records
+}
+
+// authorityRecord makes the SOA record of the domain of the name, for the
+// authority section of negative answers, so resolvers cache them for the
+// negative TTL (RFC 2308)
+func (s *server) authorityRecord(name string) miekg.RR {
+	zone := miekg.Fqdn(name)
+	for _, d := range s.domains {
+		if miekg.IsSubDomain(miekg.Fqdn(d.suffix), name) {
+			zone = miekg.Fqdn(d.suffix)
+			break
+		}
+	}
+
+	return &miekg.SOA{
+		Hdr: miekg.RR_Header{
+			Name:   zone,
+			Rrtype: miekg.TypeSOA,
+			Class:  miekg.ClassINET,
+			Ttl:    s.negativeTTL,
+		},
+		Ns:      "ns." + zone,
+		Mbox:    "hostmaster." + zone,
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  s.negativeTTL,
+	}
+}
+
+// aliasRecords makes the CNAME record of the alias, followed by the
+// records of the canonical name when it's also a registered name
+func (s *server) aliasRecords(question miekg.Question, alias aliasRecord, clientNetworks []string) []miekg.RR {
+	var records []miekg.RR
+	for i := 0; i < maxAliasChain; i++ {
+		records = append(records, &miekg.CNAME{
+			Hdr: miekg.RR_Header{
+				Name:   question.Name,
+				Rrtype: miekg.TypeCNAME,
+				Class:  miekg.ClassINET,
+				Ttl:    alias.ttl,
+			},
+			Target: miekg.Fqdn(alias.target),
+		})
+
+		if question.Qtype == miekg.TypeCNAME {
+			return records
+		}
+
+		// otherwise left to the client's resolver to follow
+		question = miekg.Question{Name: miekg.Fqdn(alias.target), Qtype: question.Qtype, Qclass: question.Qclass}
+		if !s.isServedName(question.Name) {
+			return records
+		}
+		entries, owner, ok := s.records.lookup(question.Name)
+		if !ok {
+			return records
+		}
+
+		next, ok := aliasOf(entries, owner)
+		if !ok {
+			return append(records, s.addressRecords(question, entries, clientNetworks)...)
+		}
+		alias = next
+	}
+
+	log.Printf("Alias chain of %q is too long\n", question.Name)
+	return records
+}
+
+// forwardQuery relays the query to the upstreams, answering
+// with SERVFAIL when none of them respond
+func (s *server) forwardQuery(w miekg.ResponseWriter, req *miekg.Msg) {
+	network := "udp"
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); ok {
+		network = "tcp"
+	}
+
+	resp, err := s.forward(req, network)
+	if err != nil {
+		resp = new(miekg.Msg)
+		resp.SetRcode(req, miekg.RcodeServerFailure)
+	}
+
+	if err := w.WriteMsg(resp); err != nil {
+		log.Println("Failed to write DNS response: ", err)
+	}
+}
+
+func (s *server) rotate(entries []Entry) []Entry {
+	if len(entries) < 2 {
+		return entries
+	}
+
+	offset := int(atomic.AddUint32(&s.rotation, 1) % uint32(len(entries)))
+	rotated := make([]Entry, 0, len(entries))
+	rotated = append(rotated, entries[offset:]...)
+	rotated = append(rotated, entries[:offset]...)
+	return rotated
+}
+
+// aliasRecord is the canonical name of an alias, with it's TTL
+type aliasRecord struct {
+	target string
+	ttl    uint32
+}
+
+// aliasOf returns the canonical name of the first entry which
+// publishes the host name as an alias, if any
+func aliasOf(entries []Entry, hostName string) (aliasRecord, bool) {
+	for _, entry := range entries {
+		if target, ok := entry.aliasOf(hostName); ok {
+			return aliasRecord{target: target, ttl: entry.TTL}, true
+		}
+	}
+	return aliasRecord{}, false
+}
+
+// isServedName determines whether the name is within one of the domains
+func (s *server) isServedName(name string) bool {
+	for _, d := range s.domains {
+		if miekg.IsSubDomain(miekg.Fqdn(d.suffix), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isApex determines whether the name is one of the domains itself
+func (s *server) isApex(name string) bool {
+	name = canonicalName(name)
+	for _, d := range s.domains {
+		if name == d.suffix {
+			return true
+		}
+	}
+	return false
+}
+
+// reverseIP returns the address of an in-addr.arpa or ip6.arpa
+// name, or nil for any other name
+func reverseIP(name string) net.IP {
+	name = canonicalName(name)
+	switch {
+	case strings.HasSuffix(name, ".in-addr.arpa"):
+		labels := strings.Split(strings.TrimSuffix(name, ".in-addr.arpa"), ".")
+		if len(labels) != net.IPv4len {
+			return nil
+		}
+		reverseLabels(labels)
+		return net.ParseIP(strings.Join(labels, ".")).To4()
+	case strings.HasSuffix(name, ".ip6.arpa"):
+		labels := strings.Split(strings.TrimSuffix(name, ".ip6.arpa"), ".")
+		if len(labels) != net.IPv6len*2 {
+			return nil
+		}
+		reverseLabels(labels)
+		var address strings.Builder
+		for i, label := range labels {
+			if i > 0 && i%4 == 0 {
+				address.WriteString(":")
+			}
+			address.WriteString(label)
+		}
+		return net.ParseIP(address.String())
+	}
+	return nil
+}
+
+func reverseLabels(labels []string) {
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+}
+
+func remoteIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// targetAddressRecords returns the A and AAAA records of the target
+// of an SRV record, for the additional section of the response
+func (s *server) targetAddressRecords(hostName string, clientNetworks []string) []miekg.RR {
+	entries, _, _ := s.records.lookup(hostName)
+
+	var records []miekg.RR
+	for _, entry := range entries {
+		for _, address := range sameNetwork(entry.Addresses, clientNetworks) {
+			question := miekg.Question{Name: miekg.Fqdn(hostName), Qtype: miekg.TypeANY}
+			if rr := addressRecord(question, address.IP, entry.TTL); rr != nil {
+				records = append(records, rr)
+			}
+		}
+	}
+	return records
+}
+
+// serviceRecord makes an SRV record for the target
+func serviceRecord(question miekg.Question, target serviceTarget) miekg.RR {
+	return &miekg.SRV{
+		Hdr: miekg.RR_Header{
+			Name:   question.Name,
+			Rrtype: miekg.TypeSRV,
+			Class:  miekg.ClassINET,
+			Ttl:    target.ttl,
+		},
+		Target: miekg.Fqdn(target.hostName),
+		Port:   target.port,
+	}
+}
+
+// pointerRecord makes a PTR record for the host name
+func pointerRecord(question miekg.Question, hostName string, ttl uint32) miekg.RR {
+	return &miekg.PTR{
+		Hdr: miekg.RR_Header{
+			Name:   question.Name,
+			Rrtype: miekg.TypePTR,
+			Class:  miekg.ClassINET,
+			Ttl:    ttl,
+		},
+		Ptr: miekg.Fqdn(hostName),
+	}
+}
+
+// textRecord makes a TXT record of the text strings
+func textRecord(question miekg.Question, text []string, ttl uint32) miekg.RR {
+	return &miekg.TXT{
+		Hdr: miekg.RR_Header{
+			Name:   question.Name,
+			Rrtype: miekg.TypeTXT,
+			Class:  miekg.ClassINET,
+			Ttl:    ttl,
+		},
+		Txt: text,
+	}
+}
+
+// addressRecord makes an A or AAAA record for the address
+// if it matches the type asked for in the question
+func addressRecord(question miekg.Question, address net.IP, ttl uint32) miekg.RR {
+	header := miekg.RR_Header{
+		Name:  question.Name,
+		Class: miekg.ClassINET,
+		Ttl:   ttl,
+	}
+
+	if ipv4 := address.To4(); ipv4 != nil {
+		if question.Qtype != miekg.TypeA && question.Qtype != miekg.TypeANY {
+			return nil
+		}
+		header.Rrtype = miekg.TypeA
+		return &miekg.A{Hdr: header, A: ipv4}
+	}
+
+	if question.Qtype != miekg.TypeAAAA && question.Qtype != miekg.TypeANY {
+		return nil
+	}
+	header.Rrtype = miekg.TypeAAAA
+	return &miekg.AAAA{Hdr: header, AAAA: address}
+}
@@ -0,0 +1,43 @@
+package dns
+
+import (
+	"net"
+	"testing"
+)
+
+func TestReverseIP(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "2.0.30.172.in-addr.arpa.", expected: "172.30.0.2"},
+		{name: "2.0.30.172.IN-ADDR.ARPA", expected: "172.30.0.2"},
+		{name: "255.1.168.192.in-addr.arpa.", expected: "192.168.1.255"},
+		{name: "2.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.1.0.0.0.0.0.d.f.ip6.arpa.", expected: "fd00:1::2"},
+		{name: "b.a.9.8.7.6.5.0.4.0.0.0.3.0.0.0.2.0.0.0.1.0.0.0.0.0.0.0.1.2.3.4.ip6.arpa.", expected: "4321:0:1:2:3:4:567:89ab"},
+		// zones rather than addresses
+		{name: "30.172.in-addr.arpa."},
+		{name: "0.0.0.0.0.0.0.0.1.0.0.0.0.0.d.f.ip6.arpa."},
+		// not addresses at all
+		{name: "256.0.30.172.in-addr.arpa."},
+		{name: "x.0.30.172.in-addr.arpa."},
+		{name: "1.2.0.30.172.in-addr.arpa."},
+		{name: "g.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.1.0.0.0.0.0.d.f.ip6.arpa."},
+		{name: "api.ldh.dns."},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := reverseIP(test.name)
+			if len(test.expected) == 0 {
+				if actual != nil {
+					t.Errorf("got %s, expected none", actual)
+				}
+				return
+			}
+			if !actual.Equal(net.ParseIP(test.expected)) {
+				t.Errorf("got %s, expected %s", actual, test.expected)
+			}
+		})
+	}
+}
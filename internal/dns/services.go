@@ -0,0 +1,127 @@
+package dns
+
+import (
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// wellKnownServices maps common ports to their service names, for
+// deriving SRV records from the ports exposed by a container
+var wellKnownServices = map[string]string{
+	"21":    "ftp",
+	"22":    "ssh",
+	"25":    "smtp",
+	"53":    "domain",
+	"80":    "http",
+	"389":   "ldap",
+	"443":   "https",
+	"1883":  "mqtt",
+	"3306":  "mysql",
+	"5432":  "postgresql",
+	"5672":  "amqp",
+	"6379":  "redis",
+	"8080":  "http",
+	"9200":  "elasticsearch",
+	"11211": "memcache",
+	"27017": "mongodb",
+}
+
+// containerServices returns the services published as SRV records for
+// the container, from its label followed by its exposed ports
+func (s *server) containerServices(config *container.Config) []Service {
+	var services []Service
+
+	for _, value := range strings.Split(config.Labels[s.srvLabel], ",") {
+		value = strings.TrimSpace(value)
+		if len(value) == 0 {
+			continue
+		}
+		service, err := parseService(value)
+		if err != nil {
+			log.Printf("Ignoring %q label value: %s\n", s.srvLabel, err)
+			continue
+		}
+		services = appendService(services, service)
+	}
+
+	if s.srvExposedPorts {
+		// ordered, so records are stable
+		ports := make([]string, 0, len(config.ExposedPorts))
+		for port := range config.ExposedPorts {
+			ports = append(ports, string(port))
+		}
+		sort.Strings(ports)
+
+		for _, port := range ports {
+			service, err := exposedPortService(port)
+			if err != nil {
+				log.Printf("Ignoring exposed port %q: %s\n", port, err)
+				continue
+			}
+			services = appendService(services, service)
+		}
+	}
+
+	return services
+}
+
+// parseService parses "_<service>._<proto>:<port>" values
+func parseService(value string) (Service, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return Service{}, fmt.Errorf("expected _<service>._<proto>:<port> but got %q", value)
+	}
+
+	name := strings.ToLower(strings.TrimSpace(parts[0]))
+	labels := strings.Split(name, ".")
+	if len(labels) != 2 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+		return Service{}, fmt.Errorf("invalid service name %q", parts[0])
+	}
+
+	port, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 16)
+	if err != nil || port == 0 {
+		return Service{}, fmt.Errorf("invalid port %q", parts[1])
+	}
+
+	return Service{Name: name, Port: uint16(port)}, nil
+}
+
+// exposedPortService derives the service from an exposed "<port>/<proto>",
+// named after well-known ports or otherwise after the port number itself
+func exposedPortService(value string) (Service, error) {
+	parts := strings.SplitN(value, "/", 2)
+	proto := "tcp"
+	if len(parts) == 2 {
+		proto = strings.ToLower(parts[1])
+	}
+
+	port, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil || port == 0 {
+		return Service{}, fmt.Errorf("invalid port %q", parts[0])
+	}
+
+	name, ok := wellKnownServices[parts[0]]
+	if !ok {
+		name = parts[0]
+	}
+
+	return Service{
+		Name: fmt.Sprintf("_%s._%s", name, proto),
+		Port: uint16(port),
+	}, nil
+}
+
+// appendService appends the service unless it's already been given,
+// e.g. by the label, which takes precedence over exposed ports
+func appendService(services []Service, service Service) []Service {
+	for _, existing := range services {
+		if existing.Name == service.Name {
+			return services
+		}
+	}
+	return append(services, service)
+}
@@ -0,0 +1,89 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+)
+
+const (
+	// BackendDnsmasq writes a hosts file per container into the dnsmasq hostsdir
+	BackendDnsmasq = "dnsmasq"
+	// BackendHostsFile writes all containers into a single /etc/hosts style file
+	BackendHostsFile = "hosts"
+	// BackendMemory keeps the records in memory, as used by the embedded DNS server
+	BackendMemory = "memory"
+)
+
+// Entry holds the DNS records derived from a single container.
+type Entry struct {
+	ContainerID string
+	HostNames   []string
+	Addresses   []Address
+	// Services are published as SRV records for each host name
+	Services []Service
+	// Aliases are published as CNAME records instead of the addresses
+	Aliases []Alias
+	// Text is published as a TXT record for each host name
+	Text []string
+	// TTL of the records, in seconds
+	TTL uint32
+	// Wildcard also publishes the records for any name within each host name
+	Wildcard bool
+}
+
+// aliasOf returns the canonical name the host name is an alias of, if any.
+func (e Entry) aliasOf(hostName string) (string, bool) {
+	for _, alias := range e.Aliases {
+		if canonicalName(alias.Name) == canonicalName(hostName) {
+			return alias.Target, true
+		}
+	}
+	return "", false
+}
+
+// Address is an address of a container on a network.
+type Address struct {
+	IP      net.IP
+	Network string
+}
+
+// Service is published as "<name>.<host name>" SRV record,
+// with the name being of the form "_<service>._<proto>".
+type Service struct {
+	Name string
+	Port uint16
+}
+
+// Alias is published as a "<name>" CNAME record pointing at the target.
+type Alias struct {
+	Name   string
+	Target string
+}
+
+// RecordSink receives container records as containers come and go,
+// making them available to a resolver.
+type RecordSink interface {
+	// Add registers (or replaces) the records of a container.
+	Add(entry Entry) error
+	// Remove unregisters the records of a container.
+	Remove(containerID string) error
+	// Commit applies the changes made since the last commit,
+	// e.g. by signalling the resolver to reload.
+	Commit() error
+	// List returns the IDs of the containers which have records,
+	// including any left over from a previous run.
+	List() ([]string, error)
+}
+
+func newRecordSink(config Config, domains []domain, upstreams []string) (RecordSink, error) {
+	switch config.Backend {
+	case BackendDnsmasq:
+		options := dnsmasqOptions(domains, upstreams, config.DefaultTTL, config.NegativeTTL)
+		return newDnsmasqSink(config.HostsPath, config.ConfigPath, config.PidFile, config.DefaultTTL, options), nil
+	case BackendHostsFile:
+		return newHostsFileSink(config.HostsFile), nil
+	case BackendMemory:
+		return newRecordTable(), nil
+	}
+	return nil, fmt.Errorf("unknown record backend %q", config.Backend)
+}
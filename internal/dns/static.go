@@ -0,0 +1,236 @@
+package dns
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	staticRecordsPollInterval = 5 * time.Second
+	staticEntryPrefix         = "static-"
+)
+
+// loadStaticRecords loads the static records file, if any, and
+// watches it for changes
+func (s *server) loadStaticRecords() error {
+	if len(s.staticRecordsFile) == 0 {
+		return nil
+	}
+
+	info, err := os.Stat(s.staticRecordsFile)
+	if err != nil {
+		log.Println("Error reading static records: ", err)
+		return err
+	}
+
+	err = s.reloadStaticRecords()
+	if err != nil {
+		return err
+	}
+
+	go s.watchStaticRecords(info)
+
+	return nil
+}
+
+// watchStaticRecords polls the static records file, reloading it
+// when it's modified
+func (s *server) watchStaticRecords(last os.FileInfo) {
+	ticker := time.NewTicker(staticRecordsPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(s.staticRecordsFile)
+			if err != nil {
+				log.Println("Error reading static records: ", err)
+				continue
+			}
+			if info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+				continue
+			}
+			last = info
+
+			log.Println("Reloading static records...")
+			if err := s.reloadStaticRecords(); err != nil {
+				// the previous records are kept
+				log.Println("Failed to reload static records: ", err)
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *server) reloadStaticRecords() error {
+	entries, err := s.parseStaticRecords(s.staticRecordsFile)
+	if err != nil {
+		log.Println("Error parsing static records: ", err)
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// replace all, in case the addresses of a name changed
+	for containerID := range s.staticApplied {
+		err = s.sink.Remove(containerID)
+		if err != nil {
+			return err
+		}
+		delete(s.staticApplied, containerID)
+		s.changed()
+	}
+
+	s.staticRecords = entries
+	s.staticConflicts = make(map[string]struct{})
+	return s.applyStaticRecords()
+}
+
+// applyStaticRecords adds the static records to the backend, except
+// those whose names are registered by containers, which win
+func (s *server) applyStaticRecords() error {
+	// NOTE: must be called with the lock held
+
+	staticRecords := make([]Entry, 0, len(s.gatewayRecords)+len(s.staticRecords))
+	staticRecords = append(staticRecords, s.gatewayRecords...)
+	staticRecords = append(staticRecords, s.staticRecords...)
+	if len(staticRecords) == 0 {
+		return nil
+	}
+
+	containerNames := make(map[string]string)
+	for containerID, hostNames := range s.registered {
+		for _, hostName := range hostNames {
+			containerNames[canonicalName(hostName)] = containerID
+		}
+	}
+
+	for _, entry := range staticRecords {
+		_, applied := s.staticApplied[entry.ContainerID]
+
+		if containerID, ok := containerNames[canonicalName(entry.HostNames[0])]; ok {
+			// logged once, when the conflict arises
+			if _, conflicted := s.staticConflicts[entry.ContainerID]; !conflicted {
+				log.Printf("[%s] Static record %q conflicts with container records; using the container records\n", containerID, entry.HostNames[0])
+				s.staticConflicts[entry.ContainerID] = struct{}{}
+			}
+
+			if applied {
+				err := s.sink.Remove(entry.ContainerID)
+				if err != nil {
+					return err
+				}
+				delete(s.staticApplied, entry.ContainerID)
+				s.changed()
+			}
+			continue
+		}
+		delete(s.staticConflicts, entry.ContainerID)
+
+		if applied {
+			continue
+		}
+
+		err := s.sink.Add(entry)
+		if err != nil {
+			return err
+		}
+		s.staticApplied[entry.ContainerID] = struct{}{}
+		s.changed()
+	}
+
+	return nil
+}
+
+// parseStaticRecords parses a hosts file, i.e. "<ip> <name> [<name>...]"
+// lines, into an entry per name, where names not within one of the
+// domains are relative to each of them
+func (s *server) parseStaticRecords(fileName string) ([]Entry, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	addresses := make(map[string][]Address)
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected an address followed by names", fileName, lineNumber)
+		}
+
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			return nil, fmt.Errorf("%s:%d: invalid address %q", fileName, lineNumber, fields[0])
+		}
+
+		for _, name := range fields[1:] {
+			for _, hostName := range s.staticHostNames(name) {
+				hostName, err := NormalizeName(hostName)
+				if err != nil {
+					log.Printf("%s:%d: Ignoring invalid name: %s\n", fileName, lineNumber, err)
+					continue
+				}
+				addresses[hostName] = append(addresses[hostName], Address{IP: ip})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// ordered, so the records are stable
+	hostNames := make([]string, 0, len(addresses))
+	for hostName := range addresses {
+		hostNames = append(hostNames, hostName)
+	}
+	sort.Strings(hostNames)
+
+	entries := make([]Entry, 0, len(hostNames))
+	for _, hostName := range hostNames {
+		entries = append(entries, Entry{
+			ContainerID: staticEntryPrefix + hostName,
+			HostNames:   []string{hostName},
+			Addresses:   addresses[hostName],
+			TTL:         s.defaultTTL,
+		})
+	}
+	return entries, nil
+}
+
+// staticHostNames returns the name if it's within one of the domains,
+// otherwise the name within each of the domains
+func (s *server) staticHostNames(name string) []string {
+	name = canonicalName(name)
+	for _, d := range s.domains {
+		if name == d.suffix || strings.HasSuffix(name, "."+d.suffix) {
+			return []string{name}
+		}
+	}
+
+	var hostNames []string
+	for _, d := range s.domains {
+		hostNames = append(hostNames, fmt.Sprintf("%s.%s", name, d.suffix))
+	}
+	return hostNames
+}
@@ -0,0 +1,111 @@
+package dns
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"strings"
+	"text/template"
+)
+
+// DefaultNameTemplate produces the sub-domains given by the label of the
+// domain, or the docker compose names, i.e. the label based behaviour
+const DefaultNameTemplate = `{{ join .SubDomains "," }}`
+
+// nameTemplateData is the container metadata the name template is
+// evaluated with, once for each domain
+type nameTemplateData struct {
+	ID       string
+	Name     string
+	Hostname string
+	Image    string
+	Labels   map[string]string
+	Compose  composeData
+	// Domain is the suffix the sub-domains are prepended to
+	Domain         string
+	SubDomainLabel string
+	// SubDomains are those of the label, or the docker compose names
+	SubDomains []string
+}
+
+type composeData struct {
+	Project         string
+	Service         string
+	ContainerNumber string
+}
+
+var nameTemplateFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"replace":    strings.ReplaceAll,
+	"trimPrefix": strings.TrimPrefix,
+	"trimSuffix": strings.TrimSuffix,
+	"split":      strings.Split,
+	"join":       strings.Join,
+}
+
+func parseNameTemplate(text string) (*template.Template, error) {
+	if len(strings.TrimSpace(text)) == 0 {
+		text = DefaultNameTemplate
+	}
+	return template.New("name").
+		Option("missingkey=zero").
+		Funcs(nameTemplateFuncs).
+		Parse(text)
+}
+
+// containerNames evaluates the name template for the container and
+// domain, returning the sub-domains, separated by commas or newlines
+func (s *server) containerNames(meta types.ContainerJSON, d domain) ([]string, error) {
+	labels := meta.Config.Labels
+
+	// the default template, without evaluating it
+	if !s.templatedNames {
+		return s.withRegisterAllName(s.containerSubDomains(labels, d), meta), nil
+	}
+
+	data := nameTemplateData{
+		ID:       meta.ID,
+		Name:     strings.TrimPrefix(meta.Name, "/"),
+		Hostname: meta.Config.Hostname,
+		Image:    meta.Config.Image,
+		Labels:   labels,
+		Compose: composeData{
+			Project:         labels[composeProjectLabel],
+			Service:         labels[composeServiceLabel],
+			ContainerNumber: labels[composeContainerNumberLabel],
+		},
+		Domain:         d.suffix,
+		SubDomainLabel: d.subDomainLabel,
+		SubDomains:     s.containerSubDomains(labels, d),
+	}
+
+	var buf bytes.Buffer
+	if err := s.nameTemplate.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("name template: %s", err)
+	}
+
+	// NB: names with spaces are kept whole, so they are rejected as invalid
+	var names []string
+	for _, name := range strings.FieldsFunc(buf.String(), func(r rune) bool {
+		return r == ',' || r == '\n'
+	}) {
+		name = strings.TrimSpace(name)
+		if len(name) > 0 {
+			names = appendUnique(names, name)
+		}
+	}
+	return s.withRegisterAllName(names, meta), nil
+}
+
+// withRegisterAllName adds the container name to containers without
+// names, when registering all containers
+func (s *server) withRegisterAllName(names []string, meta types.ContainerJSON) []string {
+	if len(names) > 0 {
+		return names
+	}
+	if name := s.registerAllName(meta.Name, meta.Config.Labels); len(name) > 0 {
+		return []string{name}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package dns
+
+import (
+	"fmt"
+	miekg "github.com/miekg/dns"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultUpstreamPort = "53"
+	upstreamTimeout     = 2 * time.Second
+)
+
+// parseUpstreams parses "<ip>[:<port>]" values of upstream DNS servers,
+// returning them as "<ip>:<port>" addresses
+func parseUpstreams(values []string) ([]string, error) {
+	var upstreams []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if len(value) == 0 {
+			continue
+		}
+
+		host, port, err := net.SplitHostPort(value)
+		if err != nil {
+			// without a port
+			host, port = strings.Trim(value, "[]"), defaultUpstreamPort
+		}
+
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid upstream %q; expected an IP address", value)
+		}
+		if number, err := strconv.ParseUint(port, 10, 16); err != nil || number == 0 {
+			return nil, fmt.Errorf("invalid upstream %q; expected a port number", value)
+		}
+
+		upstreams = append(upstreams, net.JoinHostPort(host, port))
+	}
+	return upstreams, nil
+}
+
+// dnsmasqServer formats the upstream address as
+// used by the dnsmasq "server" option, i.e. <ip>#<port>
+func dnsmasqServer(upstream string) string {
+	host, port, _ := net.SplitHostPort(upstream)
+	return fmt.Sprintf("%s#%s", host, port)
+}
+
+// forward relays the query to each upstream in turn,
+// returning the first response received
+func (s *server) forward(req *miekg.Msg, network string) (*miekg.Msg, error) {
+	c := &miekg.Client{Net: network, Timeout: upstreamTimeout}
+
+	var lastErr error
+	for _, upstream := range s.upstreams {
+		resp, _, err := c.Exchange(req, upstream)
+		if err != nil {
+			log.Printf("Failed to forward query to %s: %s\n", upstream, err)
+			lastErr = err
+			continue
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,81 @@
+package dns
+
+import (
+	"fmt"
+	"golang.org/x/net/idna"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxNameLength  = 253
+	maxLabelLength = 63
+)
+
+// NormalizeName validates the name against RFC 1123, after lowercasing
+// it and converting any unicode labels to punycode (IDNA), returning
+// the normalized name.
+func NormalizeName(name string) (string, error) {
+	normalized := strings.TrimSuffix(strings.TrimSpace(name), ".")
+	if len(normalized) == 0 {
+		return "", fmt.Errorf("invalid name %q: empty", name)
+	}
+
+	// NB: only unicode labels are converted, since IDNA is stricter than
+	// RFC 1123 for ASCII labels, e.g. rejecting "--" as the 3rd and 4th
+	// characters, which is reserved for punycode
+	labels := strings.Split(normalized, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			labels[i] = strings.ToLower(label)
+			continue
+		}
+		converted, err := idna.Lookup.ToASCII(label)
+		if err != nil {
+			return "", fmt.Errorf("invalid name %q: %s", name, err)
+		}
+		labels[i] = strings.ToLower(converted)
+	}
+	normalized = strings.Join(labels, ".")
+
+	if len(normalized) > maxNameLength {
+		return "", fmt.Errorf("invalid name %q: longer than %d characters", name, maxNameLength)
+	}
+
+	for _, label := range labels {
+		if err := validateLabel(label); err != nil {
+			return "", fmt.Errorf("invalid name %q: %s", name, err)
+		}
+	}
+
+	return normalized, nil
+}
+
+func isASCII(label string) bool {
+	for i := 0; i < len(label); i++ {
+		if label[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// validateLabel checks the label consists of letters, digits and
+// hyphens, not starting or ending with a hyphen (RFC 1123)
+func validateLabel(label string) error {
+	if len(label) == 0 {
+		return fmt.Errorf("empty label")
+	}
+	if len(label) > maxLabelLength {
+		return fmt.Errorf("label %q longer than %d characters", label, maxLabelLength)
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return fmt.Errorf("label %q starts or ends with a hyphen", label)
+	}
+	for _, c := range label {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return fmt.Errorf("label %q contains %q", label, c)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		valid    bool
+	}{
+		{name: "api.ldh.dns", expected: "api.ldh.dns", valid: true},
+		{name: "API.Ldh.DNS", expected: "api.ldh.dns", valid: true},
+		{name: " api.ldh.dns. ", expected: "api.ldh.dns", valid: true},
+		{name: "web-1.shop.ldh.dns", expected: "web-1.shop.ldh.dns", valid: true},
+		{name: "1.api.ldh.dns", expected: "1.api.ldh.dns", valid: true},
+		{name: "café.ldh.dns", expected: "xn--caf-dma.ldh.dns", valid: true},
+		{name: "Café.ldh.dns", expected: "xn--caf-dma.ldh.dns", valid: true},
+		{name: "ab--c.ldh.dns", expected: "ab--c.ldh.dns", valid: true},
+		{name: strings.Repeat("a", 63) + ".ldh.dns", expected: strings.Repeat("a", 63) + ".ldh.dns", valid: true},
+		{name: "", valid: false},
+		{name: ".", valid: false},
+		{name: "my api.ldh.dns", valid: false},
+		{name: "web_app.ldh.dns", valid: false},
+		{name: "api..ldh.dns", valid: false},
+		{name: "-api.ldh.dns", valid: false},
+		{name: "api-.ldh.dns", valid: false},
+		{name: strings.Repeat("a", 64) + ".ldh.dns", valid: false},
+		{name: strings.Repeat(strings.Repeat("a", 63)+".", 4) + "ldh.dns", valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := NormalizeName(test.name)
+			if !test.valid {
+				if err == nil {
+					t.Errorf("expected an error, got %q", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if actual != test.expected {
+				t.Errorf("got %q, expected %q", actual, test.expected)
+			}
+		})
+	}
+}